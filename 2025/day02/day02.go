@@ -2,24 +2,18 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"math/big"
 	"os"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
 )
 
-func partOne(intFirst int, intSecond int) int {
-	invalidIDSum := 0
-	for i := intFirst; i <= intSecond; i++ {
-		trimmedValue := strings.TrimSpace(strconv.Itoa(i))
-
-		if trimmedValue[:len(trimmedValue)/2] == trimmedValue[len(trimmedValue)/2:] {
-			invalidIDSum += i
-		}
-	}
-
-	return invalidIDSum
+type idRange struct {
+	rangeStart *big.Int
+	rangeEnd   *big.Int
 }
 
 func isInvalid(value string, seqToCheck string, seqLength int) bool {
@@ -36,27 +30,234 @@ func isInvalid(value string, seqToCheck string, seqLength int) bool {
 	return true
 }
 
-func partTwo(intFirst int, intSecond int) int {
-	invalidIDSum := 0
-	for i := intFirst; i <= intSecond; i++ {
-		trimmedValue := strings.TrimSpace(strconv.Itoa(i))
+// repeatingBlock returns the shortest block that value is made of when
+// repeated at least twice, or an empty string if there is no such block
+func repeatingBlock(value string) string {
+	for valLength := 1; valLength < len(value); valLength++ {
+		seqToCheck := value[:valLength]
+
+		if isInvalid(value, seqToCheck, valLength) {
+			return seqToCheck
+		}
+	}
+
+	return ""
+}
+
+// repeatedID builds the ID made of block written out count times
+func repeatedID(block *big.Int, count int) *big.Int {
+	id, _ := new(big.Int).SetString(strings.Repeat(block.String(), count), 10)
+	return id
+}
+
+// blockBounds finds the smallest and largest blocks of blockLen digits that,
+// repeated count times, form an ID inside r. ok is false if there are none.
+// Because repeating a block preserves its ordering, every block between lo
+// and hi also forms an ID inside r.
+func blockBounds(r idRange, blockLen, count int) (lo, hi *big.Int, ok bool) {
+	idLen := blockLen * count
+
+	// Clamp the range to the IDs that have exactly idLen digits
+	minID := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(idLen-1)), nil)
+	maxID := new(big.Int).Sub(new(big.Int).Mul(minID, big.NewInt(10)), big.NewInt(1))
+
+	low := r.rangeStart
+	if low.Cmp(minID) < 0 {
+		low = minID
+	}
+
+	high := r.rangeEnd
+	if high.Cmp(maxID) > 0 {
+		high = maxID
+	}
+
+	if low.Cmp(high) > 0 {
+		return nil, nil, false
+	}
+
+	lo, _ = new(big.Int).SetString(low.String()[:blockLen], 10)
+	if repeatedID(lo, count).Cmp(low) < 0 {
+		lo.Add(lo, big.NewInt(1))
+	}
 
-		for valLength := 1; valLength < len(trimmedValue); valLength++ {
-			seqToCheck := string(trimmedValue[:valLength])
+	hi, _ = new(big.Int).SetString(high.String()[:blockLen], 10)
+	if repeatedID(hi, count).Cmp(high) > 0 {
+		hi.Sub(hi, big.NewInt(1))
+	}
 
-			isInvalid := isInvalid(trimmedValue, seqToCheck, valLength)
+	if lo.Cmp(hi) > 0 {
+		return nil, nil, false
+	}
 
-			if isInvalid {
-				invalidIDSum += i
-				break
+	return lo, hi, true
+}
+
+// sumRepeatedIDs sums every ID inside r made of a blockLen digit block
+// repeated count times. Repeating a block is the same as multiplying it by
+// 1, 10^blockLen, 10^(2*blockLen)... added together, so the sum is the
+// arithmetic series of the blocks times that multiplier.
+func sumRepeatedIDs(r idRange, blockLen, count int) *big.Int {
+	lo, hi, ok := blockBounds(r, blockLen, count)
+	if !ok {
+		return new(big.Int)
+	}
+
+	multiplierStr := "1" + strings.Repeat(strings.Repeat("0", blockLen-1)+"1", count-1)
+	multiplier, _ := new(big.Int).SetString(multiplierStr, 10)
+
+	numBlocks := new(big.Int).Sub(hi, lo)
+	numBlocks.Add(numBlocks, big.NewInt(1))
+
+	sum := new(big.Int).Add(lo, hi)
+	sum.Mul(sum, numBlocks)
+	sum.Rsh(sum, 1)
+
+	return sum.Mul(sum, multiplier)
+}
+
+func partOne(r idRange) *big.Int {
+	invalidIDSum := new(big.Int)
+
+	// invalid IDs must have even lengths in part one
+	for idLen := len(r.rangeStart.String()); idLen <= len(r.rangeEnd.String()); idLen++ {
+		if idLen%2 == 0 {
+			invalidIDSum.Add(invalidIDSum, sumRepeatedIDs(r, idLen/2, 2))
+		}
+	}
+
+	return invalidIDSum
+}
+
+func partTwo(r idRange) *big.Int {
+	invalidIDSum := new(big.Int)
+
+	for idLen := len(r.rangeStart.String()); idLen <= len(r.rangeEnd.String()); idLen++ {
+		// An ID like 111111 repeats blocks of length 1, 2 and 3, so only count
+		// each ID under its shortest block. Those sums are built up from the
+		// shortest block length, removing the IDs of every shorter block that
+		// divides the current one.
+		shortestBlockSums := map[int]*big.Int{}
+
+		for blockLen := 1; blockLen < idLen; blockLen++ {
+			if idLen%blockLen != 0 {
+				continue
 			}
+
+			sum := sumRepeatedIDs(r, blockLen, idLen/blockLen)
+			for shorterLen, shorterSum := range shortestBlockSums {
+				if blockLen%shorterLen == 0 {
+					sum.Sub(sum, shorterSum)
+				}
+			}
+
+			shortestBlockSums[blockLen] = sum
+			invalidIDSum.Add(invalidIDSum, sum)
 		}
 	}
 
 	return invalidIDSum
 }
 
+// mergeRanges sorts the ranges and merges any that overlap so that no ID is
+// counted more than once. It also reports whether any overlaps were found.
+func mergeRanges(ranges []idRange) ([]idRange, bool) {
+	sorted := make([]idRange, len(ranges))
+	copy(sorted, ranges)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].rangeStart.Cmp(sorted[j].rangeStart) < 0
+	})
+
+	var merged []idRange
+	overlapFound := false
+
+	for _, r := range sorted {
+		if len(merged) > 0 && r.rangeStart.Cmp(merged[len(merged)-1].rangeEnd) <= 0 {
+			overlapFound = true
+
+			if r.rangeEnd.Cmp(merged[len(merged)-1].rangeEnd) > 0 {
+				merged[len(merged)-1].rangeEnd = r.rangeEnd
+			}
+			continue
+		}
+
+		merged = append(merged, r)
+	}
+
+	return merged, overlapFound
+}
+
+// invalidIDsInRange generates every invalid ID inside r in ascending order,
+// paired with the shortest block that makes it invalid
+func invalidIDsInRange(r idRange) ([]*big.Int, []string) {
+	var ids []*big.Int
+	blocks := map[string]string{}
+
+	for idLen := len(r.rangeStart.String()); idLen <= len(r.rangeEnd.String()); idLen++ {
+		for blockLen := 1; blockLen < idLen; blockLen++ {
+			if idLen%blockLen != 0 {
+				continue
+			}
+
+			lo, hi, ok := blockBounds(r, blockLen, idLen/blockLen)
+			if !ok {
+				continue
+			}
+
+			for block := lo; block.Cmp(hi) <= 0; block = new(big.Int).Add(block, big.NewInt(1)) {
+				id := repeatedID(block, idLen/blockLen)
+
+				// Skip IDs that were already generated from a shorter block
+				if repeatingBlock(id.String()) == block.String() {
+					ids = append(ids, id)
+					blocks[id.String()] = block.String()
+				}
+			}
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Cmp(ids[j]) < 0
+	})
+
+	idBlocks := make([]string, len(ids))
+	for i, id := range ids {
+		idBlocks[i] = blocks[id.String()]
+	}
+
+	return ids, idBlocks
+}
+
+// printRangeReport lists every invalid ID in each of the original ranges along
+// with the shortest repeating block that makes it invalid. IDs that are also
+// invalid in part one (a block repeated exactly twice) are marked as such.
+func printRangeReport(ranges []idRange) {
+	for _, r := range ranges {
+		fmt.Printf("Range %s-%s:\n", r.rangeStart, r.rangeEnd)
+
+		ids, idBlocks := invalidIDsInRange(r)
+		if len(ids) == 0 {
+			fmt.Println("  no invalid IDs")
+			continue
+		}
+
+		for i, id := range ids {
+			value := id.String()
+			block := idBlocks[i]
+
+			line := fmt.Sprintf("  %s: block %q repeated %d times", value, block, len(value)/len(block))
+			if len(value)%2 == 0 && value[:len(value)/2] == value[len(value)/2:] {
+				line += " (part one)"
+			}
+			fmt.Println(line)
+		}
+	}
+}
+
 func main() {
+	report := flag.Bool("report", false, "list the invalid IDs found in each range")
+	flag.Parse()
+
 	path := filepath.Join("inputs/day02.txt")
 	f, err := os.Open(path)
 	if err != nil {
@@ -66,37 +267,70 @@ func main() {
 	defer f.Close()
 
 	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), 1024*1024)
 
-	var partOneSum, partTwoSum int
+	var ranges []idRange
+	endpointsFitInt64 := true
 
 	for sc.Scan() {
 		contents := sc.Text()
-		ranges := strings.Split(contents, ",")
 
-		for _, r := range ranges {
+		for _, r := range strings.Split(contents, ",") {
+			if strings.TrimSpace(r) == "" {
+				continue
+			}
+
 			ids := strings.Split(r, "-")
 
 			strFirst := strings.TrimSpace(ids[0])
-			intFirst, err := strconv.Atoi(strFirst)
-			if err != nil {
-				panic(err)
+			bigFirst, ok := new(big.Int).SetString(strFirst, 10)
+			if !ok || bigFirst.Sign() < 0 {
+				panic(fmt.Errorf("invalid range start %q", strFirst))
 			}
 
 			strSecond := strings.TrimSpace(ids[1])
-			intSecond, err := strconv.Atoi(strSecond)
-			if err != nil {
-				panic(err)
+			bigSecond, ok := new(big.Int).SetString(strSecond, 10)
+			if !ok || bigSecond.Sign() < 0 {
+				panic(fmt.Errorf("invalid range end %q", strSecond))
 			}
 
-			// invalid IDs must have even lengths in part one
-			if len(ids[0])%2 == 0 || len(ids[1])%2 == 0 {
-				partOneSum += partOne(intFirst, intSecond)
+			if !bigFirst.IsInt64() || !bigSecond.IsInt64() {
+				endpointsFitInt64 = false
 			}
 
-			partTwoSum += partTwo(intFirst, intSecond)
+			ranges = append(ranges, idRange{rangeStart: bigFirst, rangeEnd: bigSecond})
 		}
 	}
 
-	fmt.Printf("partOneSum: %d\n", partOneSum)
-	fmt.Printf("partTwoSum: %d\n", partTwoSum)
+	mergedRanges, overlapFound := mergeRanges(ranges)
+	if overlapFound {
+		fmt.Fprintf(os.Stderr, "warning: overlapping ranges merged (%d ranges became %d)\n", len(ranges), len(mergedRanges))
+	}
+
+	partOneSum := new(big.Int)
+	partTwoSum := new(big.Int)
+
+	for _, r := range mergedRanges {
+		partOneSum.Add(partOneSum, partOne(r))
+		partTwoSum.Add(partTwoSum, partTwo(r))
+	}
+
+	if *report {
+		printRangeReport(ranges)
+	}
+
+	// The sums only ever grow, so checking the totals is enough to know
+	// whether an int64 accumulator would have overflowed along the way
+	if !endpointsFitInt64 {
+		fmt.Fprintln(os.Stderr, "note: range endpoints overflow int64")
+	}
+	if !partOneSum.IsInt64() {
+		fmt.Fprintln(os.Stderr, "note: part one sum overflows int64")
+	}
+	if !partTwoSum.IsInt64() {
+		fmt.Fprintln(os.Stderr, "note: part two sum overflows int64")
+	}
+
+	fmt.Printf("partOneSum: %s\n", partOneSum)
+	fmt.Printf("partTwoSum: %s\n", partTwoSum)
 }
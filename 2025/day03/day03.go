@@ -2,16 +2,26 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"math/big"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 )
 
 // turnOnBatteriesInBank uses a greedy algorithm to find the best ratings in the bank
 // by iterating through the bank and selecting the highest rating at each position
 // until the desired number of batteries are found while maintaining the order of the ratings.
-func turnOnBatteriesInBank(bank string, numBatteriesToFind int) int {
+// The ratings are returned as a decimal string so that any number of batteries up to the
+// length of the bank can be turned on.
+func turnOnBatteriesInBank(bank string, numBatteriesToFind int) string {
+	if numBatteriesToFind > len(bank) {
+		panic(fmt.Errorf("cannot turn on %d batteries in a bank of %d", numBatteriesToFind, len(bank)))
+	}
+
 	var bestRatings []int
 	lastSelectedPos := -1
 
@@ -38,20 +48,222 @@ func turnOnBatteriesInBank(bank string, numBatteriesToFind int) int {
 		lastSelectedPos = bestPos
 	}
 
-	var resultStr string
+	var sb strings.Builder
 	for _, rating := range bestRatings {
-		resultStr += strconv.Itoa(rating)
+		sb.WriteString(strconv.Itoa(rating))
 	}
 
-	intResult, err := strconv.Atoi(resultStr)
-	if err != nil {
-		panic(err)
+	return sb.String()
+}
+
+// bankJoltage converts the chosen ratings into a joltage. Any number of
+// batteries can be turned on, so the joltage may not fit in an int.
+func bankJoltage(ratings string) *big.Int {
+	joltage, ok := new(big.Int).SetString(ratings, 10)
+	if !ok {
+		panic(fmt.Errorf("invalid battery ratings %q", ratings))
+	}
+
+	return joltage
+}
+
+// selectBatteries finds the same best ratings as turnOnBatteriesInBank in a
+// single pass using a monotonic stack. Each rating pops the lower ratings
+// before it off the stack for as long as there are batteries left to skip,
+// so the stack always holds the best ordered selection seen so far. It
+// returns the chosen ratings along with the bank positions of the chosen batteries.
+func selectBatteries(bank string, numBatteriesToFind int) (string, []int) {
+	if numBatteriesToFind > len(bank) {
+		panic(fmt.Errorf("cannot turn on %d batteries in a bank of %d", numBatteriesToFind, len(bank)))
+	}
+
+	batteriesToSkip := len(bank) - numBatteriesToFind
+	stack := make([]int, 0, len(bank))
+
+	for bankPos := 0; bankPos < len(bank); bankPos++ {
+		if bank[bankPos] < '0' || bank[bankPos] > '9' {
+			panic(fmt.Errorf("invalid battery rating %q in bank %q", bank[bankPos], bank))
+		}
+
+		for len(stack) > 0 && batteriesToSkip > 0 && bank[stack[len(stack)-1]] < bank[bankPos] {
+			stack = stack[:len(stack)-1]
+			batteriesToSkip--
+		}
+
+		stack = append(stack, bankPos)
+	}
+
+	positions := stack[:numBatteriesToFind]
+
+	ratings := make([]byte, len(positions))
+	for i, pos := range positions {
+		ratings[i] = bank[pos]
+	}
+
+	return string(ratings), positions
+}
+
+// selectionMode describes what makes one choice of batteries better than another
+type selectionMode struct {
+	// compare orders two equal length ratings strings, best last
+	compare func(a, b string) int
+	// score is what the chosen ratings add to the total output joltage
+	score func(ratings string) *big.Int
+	// noLeadingZero rejects selections whose first rating is 0
+	noLeadingZero bool
+}
+
+func digitSum(ratings string) int {
+	sum := 0
+	for i := 0; i < len(ratings); i++ {
+		sum += int(ratings[i] - '0')
+	}
+
+	return sum
+}
+
+var selectionModes = map[string]selectionMode{
+	// The largest joltage, which is the puzzle's objective
+	"max": {
+		compare: strings.Compare,
+		score:   bankJoltage,
+	},
+	// The smallest joltage that doesn't start with a 0
+	"min": {
+		compare: func(a, b string) int {
+			return strings.Compare(b, a)
+		},
+		score:         bankJoltage,
+		noLeadingZero: true,
+	},
+	// The largest sum of ratings, with the larger joltage breaking ties
+	"digit-sum": {
+		compare: func(a, b string) int {
+			if c := digitSum(a) - digitSum(b); c != 0 {
+				return c
+			}
+			return strings.Compare(a, b)
+		},
+		score: func(ratings string) *big.Int {
+			return big.NewInt(int64(digitSum(ratings)))
+		},
+	},
+}
+
+// solveSelection chooses batteries for any selection mode, with at least
+// minGap positions between consecutive chosen batteries (a minGap of 1 allows
+// neighbouring batteries). It builds a table from the end of the bank where
+// each cell holds the best ratings for turning on j batteries from position i
+// onwards, either by skipping position i or by turning it on and continuing
+// minGap positions later. Every mode compares ratings in a way that is kept
+// when the same rating is put in front of both, so the best suffix is always
+// part of the best selection.
+func solveSelection(bank string, numBatteriesToFind int, mode selectionMode, minGap int) (string, []int) {
+	bankLen := len(bank)
+	minGap = max(minGap, 1)
+
+	best := make([][]string, bankLen+1)
+	feasible := make([][]bool, bankLen+1)
+	turnedOn := make([][]bool, bankLen+1)
+
+	for i := range best {
+		best[i] = make([]string, numBatteriesToFind+1)
+		feasible[i] = make([]bool, numBatteriesToFind+1)
+		turnedOn[i] = make([]bool, numBatteriesToFind+1)
+		feasible[i][0] = true
+	}
+
+	for i := bankLen - 1; i >= 0; i-- {
+		if bank[i] < '0' || bank[i] > '9' {
+			panic(fmt.Errorf("invalid battery rating %q in bank %q", bank[i], bank))
+		}
+
+		next := min(i+minGap, bankLen)
+
+		for j := 1; j <= numBatteriesToFind; j++ {
+			if feasible[i+1][j] {
+				best[i][j] = best[i+1][j]
+				feasible[i][j] = true
+			}
+
+			if !feasible[next][j-1] {
+				continue
+			}
+
+			// Only a full selection can have a leading rating
+			if j == numBatteriesToFind && mode.noLeadingZero && bank[i] == '0' {
+				continue
+			}
+
+			candidate := string(bank[i]) + best[next][j-1]
+			if !feasible[i][j] || mode.compare(candidate, best[i][j]) > 0 {
+				best[i][j] = candidate
+				feasible[i][j] = true
+				turnedOn[i][j] = true
+			}
+		}
+	}
+
+	if !feasible[0][numBatteriesToFind] {
+		panic(fmt.Errorf("cannot turn on %d batteries %d apart in bank %q", numBatteriesToFind, minGap, bank))
+	}
+
+	var positions []int
+	for i, j := 0, numBatteriesToFind; j > 0; {
+		if turnedOn[i][j] {
+			positions = append(positions, i)
+			i = min(i+minGap, bankLen)
+			j--
+		} else {
+			i++
+		}
+	}
+
+	return best[0][numBatteriesToFind], positions
+}
+
+// chooseBatteries uses the monotonic stack for the puzzle's own objective and
+// falls back to the general solver for any other mode or gap
+func chooseBatteries(bank string, numBatteriesToFind int, modeName string, minGap int) (string, []int) {
+	if modeName == "max" && minGap <= 1 {
+		return selectBatteries(bank, numBatteriesToFind)
+	}
+
+	return solveSelection(bank, numBatteriesToFind, selectionModes[modeName], minGap)
+}
+
+// highlightBatteries renders the bank with the chosen batteries in bold green
+func highlightBatteries(bank string, positions []int) string {
+	var sb strings.Builder
+
+	for bankPos := 0; bankPos < len(bank); bankPos++ {
+		if slices.Contains(positions, bankPos) {
+			sb.WriteString("\033[1;32m" + string(bank[bankPos]) + "\033[0m")
+		} else {
+			sb.WriteByte(bank[bankPos])
+		}
 	}
 
-	return intResult
+	return sb.String()
 }
 
 func main() {
+	show := flag.Bool("show", false, "print each bank with the batteries turned on highlighted")
+	partOneBatteries := flag.Int("part-one-batteries", 2, "number of batteries to turn on in each bank for part one")
+	partTwoBatteries := flag.Int("part-two-batteries", 12, "number of batteries to turn on in each bank for part two")
+	modeName := flag.String("mode", "max", "selection mode: max, min or digit-sum")
+	minGap := flag.Int("min-gap", 1, "minimum distance between batteries turned on in a bank")
+	flag.Parse()
+
+	mode, ok := selectionModes[*modeName]
+	if !ok {
+		panic(fmt.Errorf("unknown selection mode %q", *modeName))
+	}
+
+	if *partOneBatteries < 1 || *partTwoBatteries < 1 {
+		panic(fmt.Errorf("must turn on at least 1 battery in each bank, not %d and %d", *partOneBatteries, *partTwoBatteries))
+	}
+
 	path := filepath.Join("inputs/day03.txt")
 	f, err := os.Open(path)
 	if err != nil {
@@ -62,15 +274,27 @@ func main() {
 
 	sc := bufio.NewScanner(f)
 
-	var partOneTotalOutputJoltage, partTwoTotalOutputJoltage int
+	partOneTotalOutputJoltage := new(big.Int)
+	partTwoTotalOutputJoltage := new(big.Int)
 
 	for sc.Scan() {
 		bank := sc.Text()
 
-		partOneTotalOutputJoltage += turnOnBatteriesInBank(bank, 2)
-		partTwoTotalOutputJoltage += turnOnBatteriesInBank(bank, 12)
+		partOneRatings, partOnePositions := chooseBatteries(bank, *partOneBatteries, *modeName, *minGap)
+		partTwoRatings, partTwoPositions := chooseBatteries(bank, *partTwoBatteries, *modeName, *minGap)
+
+		partOneJoltage := mode.score(partOneRatings)
+		partTwoJoltage := mode.score(partTwoRatings)
+
+		if *show {
+			fmt.Printf("%s  %s\n", highlightBatteries(bank, partOnePositions), partOneJoltage)
+			fmt.Printf("%s  %s\n", highlightBatteries(bank, partTwoPositions), partTwoJoltage)
+		}
+
+		partOneTotalOutputJoltage.Add(partOneTotalOutputJoltage, partOneJoltage)
+		partTwoTotalOutputJoltage.Add(partTwoTotalOutputJoltage, partTwoJoltage)
 	}
 
-	fmt.Printf("Part one total output joltage: %d\n", partOneTotalOutputJoltage)
-	fmt.Printf("Part two total output joltage: %d\n", partTwoTotalOutputJoltage)
+	fmt.Printf("Part one total output joltage: %s\n", partOneTotalOutputJoltage)
+	fmt.Printf("Part two total output joltage: %s\n", partTwoTotalOutputJoltage)
 }
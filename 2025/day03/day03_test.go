@@ -0,0 +1,145 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// checkPositions fails the test unless the positions are in order and pick
+// out the ratings from the bank
+func checkPositions(t *testing.T, bank string, positions []int, ratings string) {
+	t.Helper()
+
+	fromPositions := make([]byte, len(positions))
+	for i, pos := range positions {
+		if i > 0 && pos <= positions[i-1] {
+			t.Fatalf("bank %s: positions %v are not in order", bank, positions)
+		}
+		fromPositions[i] = bank[pos]
+	}
+
+	if string(fromPositions) != ratings {
+		t.Fatalf("bank %s: positions %v give %s, not %s", bank, positions, fromPositions, ratings)
+	}
+}
+
+// randomBank builds a bank of random ratings
+func randomBank(rng *rand.Rand, bankLen int) string {
+	digits := make([]byte, bankLen)
+	for i := range digits {
+		digits[i] = byte('0' + rng.Intn(10))
+	}
+
+	return string(digits)
+}
+
+// TestSelectionMatchesGreedy checks the monotonic stack and the general solver
+// in max mode against the greedy selection on random banks, including banks
+// long enough that the joltage doesn't fit in an int
+func TestSelectionMatchesGreedy(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+
+	for range 2000 {
+		bankLen := 1 + rng.Intn(120)
+		numBatteriesToFind := 1 + rng.Intn(bankLen)
+		bank := randomBank(rng, bankLen)
+
+		greedy := turnOnBatteriesInBank(bank, numBatteriesToFind)
+
+		ratings, positions := selectBatteries(bank, numBatteriesToFind)
+		if ratings != greedy {
+			t.Fatalf("bank %s with %d batteries: greedy found %s, stack found %s", bank, numBatteriesToFind, greedy, ratings)
+		}
+		checkPositions(t, bank, positions, ratings)
+
+		solved, solvedPositions := solveSelection(bank, numBatteriesToFind, selectionModes["max"], 1)
+		if solved != greedy {
+			t.Fatalf("bank %s with %d batteries: greedy found %s, solver found %s", bank, numBatteriesToFind, greedy, solved)
+		}
+		checkPositions(t, bank, solvedPositions, solved)
+	}
+}
+
+// bruteForceSelection tries every choice of batteries at least minGap apart
+// and keeps the best one, where better reports whether a beats b and an
+// empty b stands for no choice found yet. It returns an empty string if
+// better accepts no choice at all.
+func bruteForceSelection(bank string, numBatteriesToFind int, minGap int, better func(a, b string) bool) string {
+	best := ""
+
+	var choose func(start int, chosen string)
+	choose = func(start int, chosen string) {
+		if len(chosen) == numBatteriesToFind {
+			if better(chosen, best) {
+				best = chosen
+			}
+			return
+		}
+
+		for pos := start; pos < len(bank); pos++ {
+			choose(pos+minGap, chosen+string(bank[pos]))
+		}
+	}
+	choose(0, "")
+
+	return best
+}
+
+// TestSolveSelectionModes checks every selection mode against a brute force
+// search over small random banks and gaps
+func TestSolveSelectionModes(t *testing.T) {
+	sumOf := func(ratings string) int {
+		sum := 0
+		for _, r := range ratings {
+			sum += int(r - '0')
+		}
+		return sum
+	}
+
+	// Each objective is written out directly rather than through the modes'
+	// compare functions
+	objectives := []struct {
+		modeName string
+		better   func(a, b string) bool
+	}{
+		{modeName: "max", better: func(a, b string) bool {
+			return b == "" || a > b
+		}},
+		{modeName: "min", better: func(a, b string) bool {
+			return a[0] != '0' && (b == "" || a < b)
+		}},
+		{modeName: "digit-sum", better: func(a, b string) bool {
+			return b == "" || sumOf(a) > sumOf(b) || (sumOf(a) == sumOf(b) && a > b)
+		}},
+	}
+
+	rng := rand.New(rand.NewSource(30))
+
+	for _, objective := range objectives {
+		modeName, better := objective.modeName, objective.better
+
+		for range 500 {
+			bankLen := 1 + rng.Intn(12)
+			numBatteriesToFind := 1 + rng.Intn(bankLen)
+			minGap := 1 + rng.Intn(3)
+			bank := randomBank(rng, bankLen)
+
+			want := bruteForceSelection(bank, numBatteriesToFind, minGap, better)
+			if want == "" {
+				continue
+			}
+
+			ratings, positions := solveSelection(bank, numBatteriesToFind, selectionModes[modeName], minGap)
+			if ratings != want {
+				t.Fatalf("%s mode, bank %s with %d batteries %d apart: brute force found %s, solver found %s", modeName, bank, numBatteriesToFind, minGap, want, ratings)
+			}
+			checkPositions(t, bank, positions, ratings)
+
+			for i := 1; i < len(positions); i++ {
+				if positions[i]-positions[i-1] < minGap {
+					t.Fatalf("%s mode, bank %s: positions %v are closer than %d", modeName, bank, positions, minGap)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type gridPos struct {
+	x int
+	y int
+}
+
+// comparison decides whether a cell's neighbor count satisfies a rule's threshold
+type comparison int
+
+const (
+	lessThan comparison = iota
+	lessOrEqual
+	equalTo
+	greaterOrEqual
+	greaterThan
+)
+
+func (c comparison) holds(count, threshold int) bool {
+	switch c {
+	case lessThan:
+		return count < threshold
+	case lessOrEqual:
+		return count <= threshold
+	case equalTo:
+		return count == threshold
+	case greaterOrEqual:
+		return count >= threshold
+	case greaterThan:
+		return count > threshold
+	}
+
+	return false
+}
+
+// comparisons maps the way each comparison is written on the command line to
+// the comparison
+var comparisons = map[string]comparison{
+	"<":  lessThan,
+	"<=": lessOrEqual,
+	"==": equalTo,
+	">=": greaterOrEqual,
+	">":  greaterThan,
+}
+
+var (
+	// mooreNeighborhood is the eight cells surrounding a cell
+	mooreNeighborhood = []gridPos{
+		{x: -1, y: -1}, {x: 0, y: -1}, {x: 1, y: -1},
+		{x: -1, y: 0}, {x: 1, y: 0},
+		{x: -1, y: 1}, {x: 0, y: 1}, {x: 1, y: 1},
+	}
+
+	// vonNeumannNeighborhood is the four cells sharing an edge with a cell
+	vonNeumannNeighborhood = []gridPos{
+		{x: 0, y: -1},
+		{x: -1, y: 0}, {x: 1, y: 0},
+		{x: 0, y: 1},
+	}
+
+	// neighborhoods are the standard neighborhoods by name
+	neighborhoods = map[string][]gridPos{
+		"moore":       mooreNeighborhood,
+		"von-neumann": vonNeumannNeighborhood,
+	}
+)
+
+// automatonRule describes how cells in a grid change based on how many of
+// their neighbors are occupied. A removal rule empties occupied cells whose
+// neighbor count satisfies the comparison, and a birth rule fills empty ones.
+type automatonRule struct {
+	occupied byte
+	empty    byte
+
+	// neighborhood holds the offsets of the cells counted as neighbors, which
+	// can be one of the standard neighborhoods or any custom set of offsets
+	neighborhood []gridPos
+
+	// toroidal wraps neighbors around the edges of the grid instead of
+	// treating cells past the edges as empty
+	toroidal bool
+
+	comparison comparison
+	threshold  int
+	birth      bool
+
+	// generations limits how many times the rule is applied, where 0 keeps
+	// applying it until the grid stops changing
+	generations int
+}
+
+// parseOffsets reads a custom neighborhood written as x,y offsets separated
+// by spaces
+func parseOffsets(s string) ([]gridPos, error) {
+	var offsets []gridPos
+
+	for _, offset := range strings.Fields(s) {
+		xStr, yStr, ok := strings.Cut(offset, ",")
+		if !ok {
+			return nil, fmt.Errorf("invalid neighbor offset %q", offset)
+		}
+
+		x, err := strconv.Atoi(xStr)
+		if err != nil {
+			return nil, err
+		}
+		y, err := strconv.Atoi(yStr)
+		if err != nil {
+			return nil, err
+		}
+
+		if x == 0 && y == 0 {
+			return nil, fmt.Errorf("a cell can't be its own neighbor")
+		}
+
+		offsets = append(offsets, gridPos{x: x, y: y})
+	}
+
+	if len(offsets) == 0 {
+		return nil, fmt.Errorf("no neighbor offsets in %q", s)
+	}
+
+	return offsets, nil
+}
+
+// parseRule builds a rule with no generation limit from the way it is
+// written on the command line. Custom offsets replace the named
+// neighborhood when they are given.
+func parseRule(occupied, empty, neighborhoodName, offsets, comparisonOp string, threshold int, toroidal, birth bool) (automatonRule, error) {
+	if len(occupied) != 1 || len(empty) != 1 || occupied == empty {
+		return automatonRule{}, fmt.Errorf("occupied and empty cells need two different single character symbols, not %q and %q", occupied, empty)
+	}
+
+	neighborhood, ok := neighborhoods[neighborhoodName]
+	if !ok {
+		return automatonRule{}, fmt.Errorf("unknown neighborhood %q", neighborhoodName)
+	}
+
+	if offsets != "" {
+		var err error
+		if neighborhood, err = parseOffsets(offsets); err != nil {
+			return automatonRule{}, err
+		}
+	}
+
+	c, ok := comparisons[comparisonOp]
+	if !ok {
+		return automatonRule{}, fmt.Errorf("unknown comparison %q", comparisonOp)
+	}
+
+	return automatonRule{
+		occupied:     occupied[0],
+		empty:        empty[0],
+		neighborhood: neighborhood,
+		toroidal:     toroidal,
+		comparison:   c,
+		threshold:    threshold,
+		birth:        birth,
+	}, nil
+}
+
+// wave records how many cells changed in one application of a rule and how
+// many cells were occupied afterwards
+type wave struct {
+	changed  int
+	occupied int
+}
+
+// neighborAt finds the cell at offset from x, y, or reports false if it is
+// off the edge of a bounded grid
+func (r automatonRule) neighborAt(grid [][]byte, x, y int, offset gridPos) (gridPos, bool) {
+	nx, ny := x+offset.x, y+offset.y
+
+	if r.toroidal {
+		ny = (ny%len(grid) + len(grid)) % len(grid)
+		if len(grid[ny]) == 0 {
+			return gridPos{}, false
+		}
+		nx = (nx%len(grid[ny]) + len(grid[ny])) % len(grid[ny])
+	}
+
+	if ny < 0 || ny >= len(grid) || nx < 0 || nx >= len(grid[ny]) {
+		return gridPos{}, false
+	}
+
+	return gridPos{x: nx, y: ny}, true
+}
+
+func (r automatonRule) countNeighbors(grid [][]byte, x, y int) int {
+	neighborsFound := 0
+
+	for _, offset := range r.neighborhood {
+		if pos, ok := r.neighborAt(grid, x, y, offset); ok && grid[pos.y][pos.x] == r.occupied {
+			neighborsFound++
+		}
+	}
+
+	return neighborsFound
+}
+
+// target is the symbol of the cells that the rule can change
+func (r automatonRule) target() byte {
+	if r.birth {
+		return r.empty
+	}
+
+	return r.occupied
+}
+
+// replacement is the symbol that changed cells are given
+func (r automatonRule) replacement() byte {
+	if r.birth {
+		return r.occupied
+	}
+
+	return r.empty
+}
+
+func (r automatonRule) applies(grid [][]byte, x, y int) bool {
+	return grid[y][x] == r.target() && r.comparison.holds(r.countNeighbors(grid, x, y), r.threshold)
+}
+
+// sweep finds the cells that the rule applies to in a single pass over the
+// grid. When apply is set each cell is changed as soon as it is found, so
+// cells later in the sweep already see the earlier changes.
+func (r automatonRule) sweep(grid [][]byte, apply bool) []gridPos {
+	var changedCells []gridPos
+
+	for y := 0; y < len(grid); y++ {
+		for x := 0; x < len(grid[y]); x++ {
+			if r.applies(grid, x, y) {
+				changedCells = append(changedCells, gridPos{x: x, y: y})
+
+				if apply {
+					grid[y][x] = r.replacement()
+				}
+			}
+		}
+	}
+
+	return changedCells
+}
+
+func (r automatonRule) countOccupied(grid [][]byte) int {
+	occupiedCells := 0
+	for y := range grid {
+		for x := range grid[y] {
+			if grid[y][x] == r.occupied {
+				occupiedCells++
+			}
+		}
+	}
+
+	return occupiedCells
+}
+
+// run applies the rule wave by wave until the grid stops changing or the
+// generation limit is reached. With synchronous waves every change in a wave
+// is decided from a snapshot of the grid before any of them are applied.
+// Otherwise each wave is an in-place sweep. Along with the waves it returns
+// the wave number each cell changed in, starting from 1, with 0 for cells
+// that never changed.
+func (r automatonRule) run(grid [][]byte, synchronous bool) ([]wave, [][]int) {
+	changedInWave := make([][]int, len(grid))
+	for y := range grid {
+		changedInWave[y] = make([]int, len(grid[y]))
+	}
+
+	var waves []wave
+	occupied := r.countOccupied(grid)
+
+	for r.generations == 0 || len(waves) < r.generations {
+		changedCells := r.sweep(grid, !synchronous)
+		if len(changedCells) == 0 {
+			break
+		}
+
+		for _, pos := range changedCells {
+			grid[pos.y][pos.x] = r.replacement()
+			changedInWave[pos.y][pos.x] = len(waves) + 1
+		}
+
+		if r.birth {
+			occupied += len(changedCells)
+		} else {
+			occupied -= len(changedCells)
+		}
+
+		waves = append(waves, wave{changed: len(changedCells), occupied: occupied})
+	}
+
+	return waves, changedInWave
+}
+
+// isMonotone reports whether a cell the rule applies to keeps applying as
+// other cells change. Removing cells only lowers neighbor counts and filling
+// them only raises counts, so this holds when the comparison moves the same way.
+func (r automatonRule) isMonotone() bool {
+	if r.birth {
+		return r.comparison == greaterThan || r.comparison == greaterOrEqual
+	}
+
+	return r.comparison == lessThan || r.comparison == lessOrEqual
+}
+
+// runIncrementally applies a monotone rule until the grid stops changing and
+// returns the number of cells changed. It runs the rule on the grid as a
+// lattice, so only the cells that count a changed cell as a neighbor are
+// updated. Rules that aren't monotone or have a generation limit fall back
+// to synchronous waves.
+func (r automatonRule) runIncrementally(grid [][]byte) int {
+	if !r.isMonotone() || r.generations != 0 {
+		waves, _ := r.run(grid, true)
+
+		changedCells := 0
+		for _, w := range waves {
+			changedCells += w.changed
+		}
+
+		return changedCells
+	}
+
+	g := newGridLattice(r, grid)
+
+	cells := make([]byte, g.size())
+	for cell := range cells {
+		pos := g.posOf(cell)
+		cells[cell] = grid[pos.y][pos.x]
+	}
+
+	changedCells := r.runOnLattice(g, cells)
+
+	for cell, c := range cells {
+		pos := g.posOf(cell)
+		grid[pos.y][pos.x] = c
+	}
+
+	return changedCells
+}
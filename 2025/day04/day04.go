@@ -2,56 +2,113 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
 )
 
-func getNeighborPaperRolls(grid [][]byte, x int, y int) int {
-	rollsFound := 0
-	for yPos := -1; yPos <= 1; yPos++ {
-		for xPos := -1; xPos <= 1; xPos++ {
-			if xPos == 0 && yPos == 0 {
-				continue
-			}
+// partOneRule finds the rolls of paper that a forklift can access, which are
+// those with fewer than four rolls of paper in the eight positions around them
+var partOneRule = automatonRule{
+	occupied:     '@',
+	empty:        '.',
+	neighborhood: mooreNeighborhood,
+	comparison:   lessThan,
+	threshold:    4,
+	generations:  1,
+}
 
-			if y+yPos < 0 || x+xPos < 0 || y+yPos == len(grid) || x+xPos == len(grid[0]) {
-				continue
-			}
+// partTwoRule keeps removing accessible rolls of paper until none are left
+var partTwoRule = automatonRule{
+	occupied:     '@',
+	empty:        '.',
+	neighborhood: mooreNeighborhood,
+	comparison:   lessThan,
+	threshold:    4,
+	generations:  0,
+}
+
+func cloneGrid(grid [][]byte) [][]byte {
+	clone := make([][]byte, len(grid))
+	for y := range grid {
+		clone[y] = append([]byte{}, grid[y]...)
+	}
+
+	return clone
+}
 
-			if string(grid[y+yPos][x+xPos]) == "@" {
-				rollsFound++
+// printWaveMap prints the room with each removed roll marked by the wave it
+// fell in. Waves past 9 are marked with letters, and past 35 with '+'.
+func printWaveMap(grid [][]byte, fellInWave [][]int) {
+	const waveMarks = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+	for y := range grid {
+		line := make([]byte, len(grid[y]))
+		for x := range grid[y] {
+			switch {
+			case fellInWave[y][x] >= len(waveMarks):
+				line[x] = '+'
+			case fellInWave[y][x] > 0:
+				line[x] = waveMarks[fellInWave[y][x]]
+			default:
+				line[x] = grid[y][x]
 			}
 		}
+		fmt.Println(string(line))
+	}
+}
+
+// printWaveReport prints the rolls removed and remaining after every wave,
+// followed by the wave map of the room
+func printWaveReport(grid [][]byte, waves []wave, fellInWave [][]int) {
+	for i, w := range waves {
+		fmt.Printf("Wave %d: removed %d, remaining %d\n", i+1, w.changed, w.occupied)
 	}
 
-	return rollsFound
+	printWaveMap(grid, fellInWave)
 }
 
-func sweepRoomToRemovePaperRolls(grid [][]byte, remove bool) int {
-	accessiblePaperRolls := 0
+func main() {
+	showWaves := flag.Bool("waves", false, "print a report of every removal wave in part two")
+	removal := flag.String("removal", "sync", "how removal waves are applied: sync (from a snapshot) or in-place")
+	gifPath := flag.String("gif", "", "write an animated GIF of the removal waves to this file")
+	play := flag.Bool("play", false, "replay the removal waves in the terminal")
+	cellSize := flag.Int("cell-size", 4, "size in pixels of each cell in the GIF")
+	delay := flag.Int("delay", 20, "time to show each wave for, in hundredths of a second")
+	depth := flag.Bool("depth", false, "print the removal depth of every roll and the stable core left behind")
+	occupied := flag.String("occupied", "@", "symbol of a cell holding a roll of paper")
+	empty := flag.String("empty", ".", "symbol of an empty cell")
+	neighborhoodName := flag.String("neighborhood", "moore", "cells counted as neighbors on the square lattice: moore or von-neumann")
+	offsets := flag.String("offsets", "", "space separated x,y offsets counted as neighbors on the square lattice, instead of -neighborhood")
+	comparisonOp := flag.String("comparison", "<", "how a cell's neighbor count is compared with the threshold: <, <=, ==, >= or >")
+	threshold := flag.Int("threshold", 4, "number of neighbors the comparison is made against")
+	toroidal := flag.Bool("toroidal", false, "wrap neighbors around the edges of the square lattice")
+	birth := flag.Bool("birth", false, "fill empty cells the rule applies to instead of removing rolls of paper")
+	latticeKind := flag.String("lattice", "square", "shape of the room: square, stack (2D layers separated by blank lines) or hex (space separated cells, each row indented half a hexagon from the row above)")
+	flag.Parse()
+
+	if *removal != "sync" && *removal != "in-place" {
+		panic(fmt.Errorf("unknown removal mode %q", *removal))
+	}
 
-	for y := 0; y < len(grid); y++ {
-		for x := 0; x < len(grid[y]); x++ {
-			if string(grid[y][x]) == "@" {
-				surroundingPaperRolls := getNeighborPaperRolls(grid, x, y)
+	if *cellSize <= 0 {
+		panic(fmt.Errorf("cell size %d is not a positive number of pixels", *cellSize))
+	}
 
-				if surroundingPaperRolls < 4 {
-					accessiblePaperRolls++
+	if *delay < 0 {
+		panic(fmt.Errorf("delay %d is negative", *delay))
+	}
 
-					// Remove the paper roll if it can be removed
-					if remove {
-						grid[y][x] = '.'
-					}
-				}
-			}
-		}
+	rule, err := parseRule(*occupied, *empty, *neighborhoodName, *offsets, *comparisonOp, *threshold, *toroidal, *birth)
+	if err != nil {
+		panic(err)
 	}
 
-	return accessiblePaperRolls
-}
+	// Part one applies the rule once and part two until nothing changes
+	partOneRule, partTwoRule = rule, rule
+	partOneRule.generations = 1
 
-func main() {
 	path := filepath.Join("inputs/day04.txt")
 	f, err := os.Open(path)
 	if err != nil {
@@ -69,19 +126,65 @@ func main() {
 		grid = append(grid, chars)
 	}
 
-	partOneAccessiblePaperRolls := sweepRoomToRemovePaperRolls(grid, false)
+	if *latticeKind != "square" {
+		if *showWaves || *gifPath != "" || *play || *depth {
+			panic(fmt.Errorf("wave reports are only available on the square lattice"))
+		}
+
+		lines := make([]string, len(grid))
+		for i := range grid {
+			lines[i] = string(grid[i])
+		}
+
+		var l lattice
+		var cells []byte
+
+		switch *latticeKind {
+		case "stack":
+			l, cells = parseStack(lines)
+		case "hex":
+			l, cells, err = parseHex(lines)
+			if err != nil {
+				panic(err)
+			}
+		default:
+			panic(fmt.Errorf("unknown lattice %q", *latticeKind))
+		}
+
+		fmt.Printf("Part one accessible rolls of paper: %d\n", partOneRule.countApplicable(l, cells))
+		fmt.Printf("Part two removed rolls of paper: %d\n", partTwoRule.runOnLattice(l, cells))
+		return
+	}
+
+	partOneAccessiblePaperRolls := partOneRule.runIncrementally(cloneGrid(grid))
 	fmt.Printf("Part one accessible rolls of paper: %d\n", partOneAccessiblePaperRolls)
 
-	partTwoRemovedPaperRolls := 0
+	if *showWaves || *gifPath != "" || *play {
+		waveGrid := cloneGrid(grid)
+		waves, fellInWave := partTwoRule.run(waveGrid, *removal == "sync")
+
+		if *showWaves {
+			printWaveReport(waveGrid, waves, fellInWave)
+		}
 
-	for {
-		removedPaperRolls := sweepRoomToRemovePaperRolls(grid, true)
-		partTwoRemovedPaperRolls += removedPaperRolls
+		frames := waveFrames(grid, fellInWave, len(waves))
 
-		if removedPaperRolls == 0 {
-			break
+		if *gifPath != "" {
+			if err := writeWaveGIF(*gifPath, frames, *cellSize, *delay); err != nil {
+				panic(err)
+			}
 		}
+
+		if *play {
+			playWaves(frames, *delay)
+		}
+	}
+
+	if *depth {
+		printDepthReport(grid)
 	}
 
+	partTwoRemovedPaperRolls := partTwoRule.runIncrementally(grid)
+
 	fmt.Printf("Part two removed rolls of paper: %d\n", partTwoRemovedPaperRolls)
 }
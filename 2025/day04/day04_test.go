@@ -0,0 +1,462 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// randomGrid builds a room of the given size where each cell holds a roll of
+// paper with the given chance
+func randomGrid(rng *rand.Rand, width, height int, rollChance float64) [][]byte {
+	grid := make([][]byte, height)
+	for y := range grid {
+		grid[y] = make([]byte, width)
+		for x := range grid[y] {
+			grid[y][x] = '.'
+			if rng.Float64() < rollChance {
+				grid[y][x] = '@'
+			}
+		}
+	}
+
+	return grid
+}
+
+// sweepUntilStable is the original part two, which sweeps the whole room
+// removing accessible rolls in place until a sweep removes nothing
+func sweepUntilStable(grid [][]byte) int {
+	removed := 0
+
+	for {
+		removedInSweep := 0
+
+		for y := range grid {
+			for x := range grid[y] {
+				if grid[y][x] != '@' {
+					continue
+				}
+
+				neighbors := 0
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						ny, nx := y+dy, x+dx
+						if (dx != 0 || dy != 0) && ny >= 0 && ny < len(grid) && nx >= 0 && nx < len(grid[ny]) && grid[ny][nx] == '@' {
+							neighbors++
+						}
+					}
+				}
+
+				if neighbors < 4 {
+					grid[y][x] = '.'
+					removedInSweep++
+				}
+			}
+		}
+
+		removed += removedInSweep
+		if removedInSweep == 0 {
+			return removed
+		}
+	}
+}
+
+func totalChanged(waves []wave) int {
+	changed := 0
+	for _, w := range waves {
+		changed += w.changed
+	}
+
+	return changed
+}
+
+func sameGrid(a, b [][]byte) bool {
+	for y := range a {
+		if string(a[y]) != string(b[y]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// TestIncrementalRemovalMatchesSweeps checks that the incremental removal
+// removes the same rolls as the original sweep loop and as synchronous and
+// in-place waves on random rooms
+func TestIncrementalRemovalMatchesSweeps(t *testing.T) {
+	rng := rand.New(rand.NewSource(31))
+
+	for range 500 {
+		grid := randomGrid(rng, 1+rng.Intn(30), 1+rng.Intn(30), rng.Float64())
+
+		swept := cloneGrid(grid)
+		want := sweepUntilStable(swept)
+
+		incremental := cloneGrid(grid)
+		if got := partTwoRule.runIncrementally(incremental); got != want || !sameGrid(incremental, swept) {
+			t.Fatalf("incremental removal removed %d rolls, sweeps removed %d, in room %q", got, want, grid)
+		}
+
+		for _, synchronous := range []bool{true, false} {
+			waveGrid := cloneGrid(grid)
+			waves, _ := partTwoRule.run(waveGrid, synchronous)
+
+			if got := totalChanged(waves); got != want || !sameGrid(waveGrid, swept) {
+				t.Fatalf("waves with synchronous=%t removed %d rolls, sweeps removed %d, in room %q", synchronous, got, want, grid)
+			}
+		}
+	}
+}
+
+func TestComparisonHolds(t *testing.T) {
+	// Each comparison against a threshold of 4 for counts 3, 4 and 5
+	want := map[string][3]bool{
+		"<":  {true, false, false},
+		"<=": {true, true, false},
+		"==": {false, true, false},
+		">=": {false, true, true},
+		">":  {false, false, true},
+	}
+
+	for op, holds := range want {
+		for i, count := range []int{3, 4, 5} {
+			if got := comparisons[op].holds(count, 4); got != holds[i] {
+				t.Errorf("%d %s 4 gave %t, want %t", count, op, got, holds[i])
+			}
+		}
+	}
+}
+
+// TestNeighborhoods counts the neighbors of the middle and a corner of a full
+// 3x3 room with each kind of neighborhood and edge
+func TestNeighborhoods(t *testing.T) {
+	grid := [][]byte{[]byte("@@@"), []byte("@@@"), []byte("@@@")}
+
+	rightAndBelow, err := parseOffsets("1,0 0,1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		neighborhood []gridPos
+		toroidal     bool
+		middle       int
+		corner       int
+	}{
+		{name: "moore", neighborhood: mooreNeighborhood, middle: 8, corner: 3},
+		{name: "von-neumann", neighborhood: vonNeumannNeighborhood, middle: 4, corner: 2},
+		{name: "custom", neighborhood: rightAndBelow, middle: 2, corner: 0},
+		{name: "toroidal moore", neighborhood: mooreNeighborhood, toroidal: true, middle: 8, corner: 8},
+		{name: "toroidal von-neumann", neighborhood: vonNeumannNeighborhood, toroidal: true, middle: 4, corner: 4},
+	}
+
+	for _, tt := range tests {
+		r := automatonRule{occupied: '@', empty: '.', neighborhood: tt.neighborhood, toroidal: tt.toroidal}
+
+		if got := r.countNeighbors(grid, 1, 1); got != tt.middle {
+			t.Errorf("%s: middle has %d neighbors, want %d", tt.name, got, tt.middle)
+		}
+		if got := r.countNeighbors(grid, 2, 2); got != tt.corner {
+			t.Errorf("%s: bottom right corner has %d neighbors, want %d", tt.name, got, tt.corner)
+		}
+	}
+}
+
+// TestBirthRule fills the gaps between rolls until every empty cell has
+// fewer than two rolls beside it
+func TestBirthRule(t *testing.T) {
+	r, err := parseRule("@", ".", "von-neumann", "", ">=", 2, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grid := [][]byte{[]byte("@.@.@"), []byte(".....")}
+	want := []string{"@@@@@", "....."}
+
+	if changed := r.runIncrementally(grid); changed != 2 {
+		t.Errorf("filled %d cells, want 2", changed)
+	}
+
+	for y := range want {
+		if string(grid[y]) != want[y] {
+			t.Fatalf("room is %q, want %q", grid, want)
+		}
+	}
+}
+
+// TestRuleOptionsAgree runs rules with every kind of neighborhood, edge and
+// change incrementally and as synchronous waves on random rooms, and checks
+// they end the same
+func TestRuleOptionsAgree(t *testing.T) {
+	rng := rand.New(rand.NewSource(33))
+
+	var rules []automatonRule
+	for _, offsets := range []string{"", "1,0 0,1 -2,-1"} {
+		for _, neighborhoodName := range []string{"moore", "von-neumann"} {
+			for _, op := range []string{"<", "<=", "==", ">=", ">"} {
+				for _, toroidal := range []bool{false, true} {
+					for _, birth := range []bool{false, true} {
+						r, err := parseRule("#", "-", neighborhoodName, offsets, op, 2, toroidal, birth)
+						if err != nil {
+							t.Fatal(err)
+						}
+						rules = append(rules, r)
+					}
+				}
+			}
+		}
+	}
+
+	for range 20 {
+		grid := randomGrid(rng, 1+rng.Intn(15), 1+rng.Intn(15), rng.Float64())
+		for y := range grid {
+			for x := range grid[y] {
+				grid[y][x] = map[byte]byte{'@': '#', '.': '-'}[grid[y][x]]
+			}
+		}
+
+		for _, r := range rules {
+			// Rules that aren't monotone can keep flipping cells forever
+			if !r.isMonotone() {
+				r.generations = 3
+			}
+
+			waveGrid := cloneGrid(grid)
+			waves, _ := r.run(waveGrid, true)
+
+			incremental := cloneGrid(grid)
+			if got := r.runIncrementally(incremental); got != totalChanged(waves) || !sameGrid(incremental, waveGrid) {
+				t.Fatalf("rule %+v changed %d cells incrementally and %d in waves in room %q", r, got, totalChanged(waves), grid)
+			}
+		}
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	tests := []struct {
+		occupied, empty, neighborhood, offsets, comparison string
+	}{
+		{occupied: "@@", empty: ".", neighborhood: "moore", comparison: "<"},
+		{occupied: "@", empty: "@", neighborhood: "moore", comparison: "<"},
+		{occupied: "@", empty: ".", neighborhood: "hex", comparison: "<"},
+		{occupied: "@", empty: ".", neighborhood: "moore", offsets: "0,0", comparison: "<"},
+		{occupied: "@", empty: ".", neighborhood: "moore", offsets: "1", comparison: "<"},
+		{occupied: "@", empty: ".", neighborhood: "moore", comparison: "="},
+	}
+
+	for _, tt := range tests {
+		if _, err := parseRule(tt.occupied, tt.empty, tt.neighborhood, tt.offsets, tt.comparison, 4, false, false); err == nil {
+			t.Errorf("rule %+v parsed without an error", tt)
+		}
+	}
+}
+
+// latticeWaves removes every roll the rule applies to at once, over and over
+// until none are left to remove, for checking runOnLattice against
+func latticeWaves(r automatonRule, l lattice, cells []byte) int {
+	removed := 0
+
+	for {
+		var applicable []int
+		for cell := 0; cell < l.size(); cell++ {
+			if cells[cell] == r.target() && r.comparison.holds(r.countLatticeNeighbors(l, cells, cell), r.threshold) {
+				applicable = append(applicable, cell)
+			}
+		}
+
+		if len(applicable) == 0 {
+			return removed
+		}
+
+		for _, cell := range applicable {
+			cells[cell] = r.replacement()
+		}
+		removed += len(applicable)
+	}
+}
+
+// TestSingleLayerStackMatchesSquare checks that a stack of one layer is the
+// same room as the square grid
+func TestSingleLayerStackMatchesSquare(t *testing.T) {
+	rng := rand.New(rand.NewSource(36))
+
+	for range 200 {
+		grid := randomGrid(rng, 1+rng.Intn(20), 1+rng.Intn(20), rng.Float64())
+
+		lines := make([]string, len(grid))
+		for y := range grid {
+			lines[y] = string(grid[y])
+		}
+
+		box, cells := parseStack(lines)
+
+		if got, want := partOneRule.countApplicable(box, cells), partOneRule.runIncrementally(cloneGrid(grid)); got != want {
+			t.Fatalf("stack found %d accessible rolls, square grid found %d, in room %q", got, want, grid)
+		}
+		if got, want := partTwoRule.runOnLattice(box, cells), partTwoRule.runIncrementally(cloneGrid(grid)); got != want {
+			t.Fatalf("stack removed %d rolls, square grid removed %d, in room %q", got, want, grid)
+		}
+	}
+}
+
+// TestStackNeighbors checks that the middle of a 3x3x3 stack touches every
+// other cell and a corner touches the seven cells around it
+func TestStackNeighbors(t *testing.T) {
+	box, _ := parseStack([]string{"...", "...", "...", "", "...", "...", "...", "", "...", "...", "..."})
+
+	if box.size() != 27 {
+		t.Fatalf("stack has %d cells, want 27", box.size())
+	}
+	if got := len(box.neighbors(13)); got != 26 {
+		t.Errorf("middle has %d neighbors, want 26", got)
+	}
+	if got := len(box.neighbors(0)); got != 7 {
+		t.Errorf("corner has %d neighbors, want 7", got)
+	}
+}
+
+// TestHexagonNeighbors checks a hexagon-shaped room two cells from its middle
+// to its edge, where the six corners have 3 neighbors, the other cells on
+// the edge have 4 and the seven inside cells have 6
+func TestHexagonNeighbors(t *testing.T) {
+	hex, cells, err := parseHex([]string{
+		"  @ @ @",
+		" @ @ @ @",
+		"@ @ @ @ @",
+		" @ @ @ @",
+		"  @ @ @",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cells) != 19 || hex.size() != 19 {
+		t.Fatalf("hexagon has %d cells, want 19", hex.size())
+	}
+
+	neighborCounts := map[int]int{}
+	for cell := 0; cell < hex.size(); cell++ {
+		neighborCounts[len(hex.neighbors(cell))]++
+	}
+
+	if neighborCounts[3] != 6 || neighborCounts[4] != 6 || neighborCounts[6] != 7 || len(neighborCounts) != 3 {
+		t.Errorf("cells by neighbor count are %v, want 6 with 3, 6 with 4 and 7 with 6", neighborCounts)
+	}
+
+	// With every cell full only the corners can be reached
+	if got := partOneRule.countApplicable(hex, cells); got != 6 {
+		t.Errorf("%d accessible rolls, want the 6 corners", got)
+	}
+}
+
+// TestParallelogramNeighbors checks that a room with every row indented one
+// more than the row above is a parallelogram in axial coordinates, where the
+// cell at q, r neighbors q±1, r and q, r±1 and q+1, r-1 and q-1, r+1
+func TestParallelogramNeighbors(t *testing.T) {
+	const width, height = 4, 3
+
+	lines := []string{"a b c d", " e f g h", "  i j k l"}
+
+	hex, cells, err := parseHex(lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(cells) != "abcdefghijkl" {
+		t.Fatalf("cells are %q", cells)
+	}
+
+	for r := 0; r < height; r++ {
+		for q := 0; q < width; q++ {
+			want := map[byte]bool{}
+			for _, offset := range [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}, {1, -1}, {-1, 1}} {
+				nq, nr := q+offset[0], r+offset[1]
+				if nq >= 0 && nq < width && nr >= 0 && nr < height {
+					want[cells[nr*width+nq]] = true
+				}
+			}
+
+			got := map[byte]bool{}
+			for _, neighbor := range hex.neighbors(r*width + q) {
+				got[cells[neighbor]] = true
+			}
+
+			if len(got) != len(want) {
+				t.Fatalf("cell %c has neighbors %v, want %v", cells[r*width+q], got, want)
+			}
+			for c := range want {
+				if !got[c] {
+					t.Fatalf("cell %c has neighbors %v, want %v", cells[r*width+q], got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestParseHexErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+	}{
+		{name: "between two hexagons", lines: []string{"@ @ @", "@ @ @"}},
+		{name: "between two hexagons", lines: []string{"@  @"}},
+		{name: "gap", lines: []string{"@   @"}},
+	}
+
+	for _, tt := range tests {
+		_, _, err := parseHex(tt.lines)
+		if err == nil || !strings.Contains(err.Error(), tt.name) {
+			t.Errorf("lines %q gave error %v, want one about a %s", tt.lines, err, tt.name)
+		}
+	}
+}
+
+// TestRunOnLatticeMatchesWaves checks the incremental removal on random stacks
+// and hexagon-shaped rooms against removing every accessible roll at once
+func TestRunOnLatticeMatchesWaves(t *testing.T) {
+	rng := rand.New(rand.NewSource(136))
+
+	for range 200 {
+		layers := 1 + rng.Intn(4)
+		var stackLines []string
+		for z := range layers {
+			if z > 0 {
+				stackLines = append(stackLines, "")
+			}
+			for _, row := range randomGrid(rng, 1+rng.Intn(6), 1+rng.Intn(6), rng.Float64()) {
+				stackLines = append(stackLines, string(row))
+			}
+		}
+
+		// A hexagon of the given radius, indented less towards its middle
+		radius := rng.Intn(5)
+		var hexLines []string
+		for r := -radius; r <= radius; r++ {
+			row := []byte(strings.Repeat(" ", max(r, -r)))
+			for i := 0; i < 2*radius+1-max(r, -r); i++ {
+				if i > 0 {
+					row = append(row, ' ')
+				}
+				row = append(row, ".@"[rng.Intn(2)])
+			}
+			hexLines = append(hexLines, string(row))
+		}
+
+		box, boxCells := parseStack(stackLines)
+		hex, hexCells, err := parseHex(hexLines)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, room := range []struct {
+			l     lattice
+			cells []byte
+		}{{l: box, cells: boxCells}, {l: hex, cells: hexCells}} {
+			want := latticeWaves(partTwoRule, room.l, append([]byte{}, room.cells...))
+			if got := partTwoRule.runOnLattice(room.l, room.cells); got != want {
+				t.Fatalf("removed %d rolls, waves removed %d, from %q", got, want, room.cells)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// removalDepths finds the depth of every roll, which is the synchronous wave
+// it becomes accessible in, starting from 1. Rolls that are never accessible
+// make up the stable core and have a depth of 0.
+func removalDepths(grid [][]byte) ([][]int, int) {
+	waves, depths := partTwoRule.run(cloneGrid(grid), true)
+
+	return depths, len(waves)
+}
+
+// stableCoreComponents groups the rolls of the stable core into the sets of
+// rolls connected through the rule's neighborhood, largest first
+func stableCoreComponents(grid [][]byte, depths [][]int) [][]gridPos {
+	inCore := func(pos gridPos) bool {
+		return grid[pos.y][pos.x] == partTwoRule.occupied && depths[pos.y][pos.x] == 0
+	}
+
+	visited := make([][]bool, len(grid))
+	for y := range grid {
+		visited[y] = make([]bool, len(grid[y]))
+	}
+
+	var components [][]gridPos
+
+	for y := range grid {
+		for x := range grid[y] {
+			start := gridPos{x: x, y: y}
+			if visited[y][x] || !inCore(start) {
+				continue
+			}
+
+			visited[y][x] = true
+			component := []gridPos{start}
+
+			// The component doubles as the BFS queue, since every roll added to
+			// it still needs its own neighbors checked
+			for i := 0; i < len(component); i++ {
+				for _, offset := range partTwoRule.neighborhood {
+					pos, ok := partTwoRule.neighborAt(grid, component[i].x, component[i].y, offset)
+					if !ok || visited[pos.y][pos.x] || !inCore(pos) {
+						continue
+					}
+
+					visited[pos.y][pos.x] = true
+					component = append(component, pos)
+				}
+			}
+
+			components = append(components, component)
+		}
+	}
+
+	slices.SortStableFunc(components, func(a, b []gridPos) int {
+		return len(b) - len(a)
+	})
+
+	return components
+}
+
+// printDepthReport prints the depth map of the room, a histogram of how many
+// rolls there are at each depth, and the connected components of the stable core
+func printDepthReport(grid [][]byte) {
+	depths, maxDepth := removalDepths(grid)
+
+	fmt.Println("Removal depth map:")
+	printWaveMap(grid, depths)
+
+	depthCounts := make([]int, maxDepth+1)
+	for y := range grid {
+		for x := range grid[y] {
+			if grid[y][x] == partTwoRule.occupied {
+				depthCounts[depths[y][x]]++
+			}
+		}
+	}
+
+	largestDepthCount := 0
+	if maxDepth > 0 {
+		largestDepthCount = slices.Max(depthCounts[1:])
+	}
+
+	fmt.Println("Removal depth histogram:")
+	for depth := 1; depth <= maxDepth; depth++ {
+		barLen := (depthCounts[depth]*50 + largestDepthCount - 1) / largestDepthCount
+		fmt.Printf("%4d | %-50s %d\n", depth, strings.Repeat("#", barLen), depthCounts[depth])
+	}
+
+	components := stableCoreComponents(grid, depths)
+
+	fmt.Printf("Stable core: %d rolls in %d components\n", depthCounts[0], len(components))
+	for i, component := range components {
+		fmt.Printf("  Component %d: %d rolls, starting at %d,%d\n", i+1, len(component), component[0].x, component[0].y)
+	}
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// lattice is a set of cells that can each hold a roll of paper, along with
+// which cells each cell counts as its neighbors. Cells are numbered from 0 to
+// size()-1.
+type lattice interface {
+	size() int
+	neighbors(cell int) []int
+}
+
+// gridLattice is a square grid seen as a lattice, where a cell's neighbors
+// are the cells at the rule's neighborhood offsets. Cells are numbered row by
+// row, and rows can be different lengths.
+type gridLattice struct {
+	rule      automatonRule
+	grid      [][]byte
+	rowStarts []int
+}
+
+func newGridLattice(r automatonRule, grid [][]byte) gridLattice {
+	rowStarts := make([]int, len(grid)+1)
+	for y := range grid {
+		rowStarts[y+1] = rowStarts[y] + len(grid[y])
+	}
+
+	return gridLattice{rule: r, grid: grid, rowStarts: rowStarts}
+}
+
+func (g gridLattice) size() int {
+	return g.rowStarts[len(g.grid)]
+}
+
+func (g gridLattice) posOf(cell int) gridPos {
+	// The row holding the cell is the last row starting at or before it
+	y := sort.Search(len(g.grid), func(y int) bool { return g.rowStarts[y+1] > cell })
+
+	return gridPos{x: cell - g.rowStarts[y], y: y}
+}
+
+func (g gridLattice) neighbors(cell int) []int {
+	pos := g.posOf(cell)
+	var neighborCells []int
+
+	for _, offset := range g.rule.neighborhood {
+		if neighbor, ok := g.rule.neighborAt(g.grid, pos.x, pos.y, offset); ok {
+			neighborCells = append(neighborCells, g.rowStarts[neighbor.y]+neighbor.x)
+		}
+	}
+
+	return neighborCells
+}
+
+// boxLattice is a box of cells in any number of dimensions where every cell
+// neighbors all of the cells it touches, even only at a corner. In three
+// dimensions that gives each cell 26 neighbors.
+type boxLattice struct {
+	dims    []int
+	offsets [][]int
+}
+
+func newBoxLattice(dims []int) boxLattice {
+	// Build every combination of -1, 0 and 1 across the dimensions, except
+	// for the cell itself
+	offsets := [][]int{{}}
+	for range dims {
+		var extended [][]int
+		for _, offset := range offsets {
+			for d := -1; d <= 1; d++ {
+				extended = append(extended, append(append([]int{}, offset...), d))
+			}
+		}
+		offsets = extended
+	}
+
+	offsets = append(offsets[:len(offsets)/2], offsets[len(offsets)/2+1:]...)
+
+	return boxLattice{dims: dims, offsets: offsets}
+}
+
+func (b boxLattice) size() int {
+	cells := 1
+	for _, d := range b.dims {
+		cells *= d
+	}
+
+	return cells
+}
+
+// coords converts a cell number into its position, with the first
+// dimension changing fastest
+func (b boxLattice) coords(cell int) []int {
+	coords := make([]int, len(b.dims))
+	for i, d := range b.dims {
+		coords[i] = cell % d
+		cell /= d
+	}
+
+	return coords
+}
+
+func (b boxLattice) neighbors(cell int) []int {
+	coords := b.coords(cell)
+	var neighborCells []int
+
+	for _, offset := range b.offsets {
+		neighbor := 0
+		stride := 1
+		inBounds := true
+
+		for i, d := range b.dims {
+			c := coords[i] + offset[i]
+			if c < 0 || c >= d {
+				inBounds = false
+				break
+			}
+
+			neighbor += c * stride
+			stride *= d
+		}
+
+		if inBounds {
+			neighborCells = append(neighborCells, neighbor)
+		}
+	}
+
+	return neighborCells
+}
+
+// hexLattice is a grid of hexagons in axial coordinates, where row r holds
+// the cells q = rowOffsets[r], rowOffsets[r]+1... and each cell has six
+// neighbors
+type hexLattice struct {
+	rowStarts  []int
+	rowOffsets []int
+	rowLens    []int
+}
+
+var hexOffsets = []struct{ q, r int }{
+	{q: 1, r: 0}, {q: -1, r: 0},
+	{q: 0, r: 1}, {q: 0, r: -1},
+	{q: 1, r: -1}, {q: -1, r: 1},
+}
+
+func newHexLattice(rowOffsets, rowLens []int) hexLattice {
+	rowStarts := make([]int, len(rowLens))
+	for r := 1; r < len(rowLens); r++ {
+		rowStarts[r] = rowStarts[r-1] + rowLens[r-1]
+	}
+
+	return hexLattice{rowStarts: rowStarts, rowOffsets: rowOffsets, rowLens: rowLens}
+}
+
+func (h hexLattice) size() int {
+	if len(h.rowLens) == 0 {
+		return 0
+	}
+
+	return h.rowStarts[len(h.rowStarts)-1] + h.rowLens[len(h.rowLens)-1]
+}
+
+func (h hexLattice) neighbors(cell int) []int {
+	// Find the row holding the cell, which is the last row starting at or before it
+	r := len(h.rowStarts) - 1
+	for h.rowStarts[r] > cell {
+		r--
+	}
+	q := h.rowOffsets[r] + cell - h.rowStarts[r]
+
+	var neighborCells []int
+
+	for _, offset := range hexOffsets {
+		nq, nr := q+offset.q, r+offset.r
+		if nr < 0 || nr >= len(h.rowLens) {
+			continue
+		}
+
+		i := nq - h.rowOffsets[nr]
+		if i < 0 || i >= h.rowLens[nr] {
+			continue
+		}
+
+		neighborCells = append(neighborCells, h.rowStarts[nr]+i)
+	}
+
+	return neighborCells
+}
+
+// parseStack reads 2D layers separated by blank lines into a 3D box, padding
+// smaller layers with empty cells
+func parseStack(lines []string) (boxLattice, []byte) {
+	var layers [][]string
+	var layer []string
+
+	for _, line := range lines {
+		if len(line) == 0 {
+			if len(layer) > 0 {
+				layers = append(layers, layer)
+				layer = nil
+			}
+			continue
+		}
+
+		layer = append(layer, line)
+	}
+
+	if len(layer) > 0 {
+		layers = append(layers, layer)
+	}
+
+	width, height := 0, 0
+	for _, l := range layers {
+		height = max(height, len(l))
+		for _, line := range l {
+			width = max(width, len(line))
+		}
+	}
+
+	box := newBoxLattice([]int{width, height, len(layers)})
+	cells := make([]byte, box.size())
+	for i := range cells {
+		cells[i] = partTwoRule.empty
+	}
+
+	for z, l := range layers {
+		for y, line := range l {
+			for x := 0; x < len(line); x++ {
+				cells[x+width*(y+height*z)] = line[x]
+			}
+		}
+	}
+
+	return box, cells
+}
+
+// parseHex reads a hex grid drawn the way hexagons tile, with a space between
+// the cells on each row and every row shifted half a cell from the rows next
+// to it. A cell's axial q coordinate comes from its column, so the
+// indentation of each row sets where it starts. A parallelogram has each row
+// indented one more character than the row above it, while a hexagon-shaped
+// room has its rows indented less towards its middle.
+func parseHex(lines []string) (hexLattice, []byte, error) {
+	var rowOffsets, rowLens []int
+	var cells []byte
+
+	// Moving one row down shifts the cells one character right, so the column
+	// of the cell at q on row r is 2q + r + shift
+	shift := 0
+	shiftFound := false
+
+	for lineNum, line := range lines {
+		r := len(rowLens)
+		rowLen := 0
+
+		for col := 0; col < len(line); col++ {
+			if line[col] == ' ' {
+				continue
+			}
+
+			if !shiftFound {
+				shift = (col - r) % 2
+				shiftFound = true
+			}
+
+			if (col-r-shift)%2 != 0 {
+				return hexLattice{}, nil, fmt.Errorf("line %d column %d is between two hexagons", lineNum+1, col+1)
+			}
+
+			q := (col - r - shift) / 2
+			if rowLen == 0 {
+				rowOffsets = append(rowOffsets, q)
+			} else if q != rowOffsets[r]+rowLen {
+				return hexLattice{}, nil, fmt.Errorf("line %d has a gap before column %d", lineNum+1, col+1)
+			}
+
+			cells = append(cells, line[col])
+			rowLen++
+		}
+
+		if rowLen > 0 {
+			rowLens = append(rowLens, rowLen)
+		}
+	}
+
+	return newHexLattice(rowOffsets, rowLens), cells, nil
+}
+
+func (r automatonRule) countLatticeNeighbors(l lattice, cells []byte, cell int) int {
+	neighborsFound := 0
+	for _, neighbor := range l.neighbors(cell) {
+		if cells[neighbor] == r.occupied {
+			neighborsFound++
+		}
+	}
+
+	return neighborsFound
+}
+
+// countApplicable counts the cells the rule applies to without changing any
+// of them, which is the same as applying it for a single generation
+func (r automatonRule) countApplicable(l lattice, cells []byte) int {
+	applicable := 0
+
+	for cell := 0; cell < l.size(); cell++ {
+		if cells[cell] == r.target() && r.comparison.holds(r.countLatticeNeighbors(l, cells, cell), r.threshold) {
+			applicable++
+		}
+	}
+
+	return applicable
+}
+
+// runOnLattice applies a monotone rule to the cells of a lattice until they
+// stop changing, and returns the number of cells changed. It keeps a neighbor
+// count for every target cell and a queue of cells the rule applies to, so
+// each change only updates the cells that count the changed cell as a
+// neighbor.
+func (r automatonRule) runOnLattice(l lattice, cells []byte) int {
+	neighborCounts := make([]int, l.size())
+	queued := make([]bool, l.size())
+	var queue []int
+
+	// countedBy holds the cells that count each cell as a neighbor, which
+	// are only the same as its own neighbors if the neighborhood is symmetric
+	countedBy := make([][]int, l.size())
+
+	for cell := 0; cell < l.size(); cell++ {
+		for _, neighbor := range l.neighbors(cell) {
+			countedBy[neighbor] = append(countedBy[neighbor], cell)
+		}
+	}
+
+	for cell := 0; cell < l.size(); cell++ {
+		if cells[cell] != r.target() {
+			continue
+		}
+
+		neighborCounts[cell] = r.countLatticeNeighbors(l, cells, cell)
+		if r.comparison.holds(neighborCounts[cell], r.threshold) {
+			queued[cell] = true
+			queue = append(queue, cell)
+		}
+	}
+
+	countChange := -1
+	if r.birth {
+		countChange = 1
+	}
+
+	changedCells := 0
+
+	for len(queue) > 0 {
+		cell := queue[0]
+		queue = queue[1:]
+
+		cells[cell] = r.replacement()
+		changedCells++
+
+		for _, counter := range countedBy[cell] {
+			if cells[counter] != r.target() {
+				continue
+			}
+
+			neighborCounts[counter] += countChange
+
+			if r.comparison.holds(neighborCounts[counter], r.threshold) && !queued[counter] {
+				queued[counter] = true
+				queue = append(queue, counter)
+			}
+		}
+	}
+
+	return changedCells
+}
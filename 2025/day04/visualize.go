@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"strings"
+	"time"
+)
+
+// cellState is how a cell is drawn in one frame of a removal animation
+type cellState uint8
+
+const (
+	emptyCell cellState = iota
+	stableRoll
+	removingRoll
+)
+
+var framePalette = color.Palette{
+	emptyCell:    color.RGBA{R: 0x1e, G: 0x1e, B: 0x24, A: 0xff},
+	stableRoll:   color.RGBA{R: 0xd8, G: 0xd0, B: 0xb8, A: 0xff},
+	removingRoll: color.RGBA{R: 0xe0, G: 0x40, B: 0x30, A: 0xff},
+}
+
+// waveFrames rebuilds the room as it was before every wave, with the rolls
+// that are about to be removed in that wave marked, followed by the room
+// left after the last wave
+func waveFrames(grid [][]byte, fellInWave [][]int, numWaves int) [][][]cellState {
+	frames := make([][][]cellState, 0, numWaves+1)
+
+	for waveNum := 1; waveNum <= numWaves+1; waveNum++ {
+		frame := make([][]cellState, len(grid))
+
+		for y := range grid {
+			frame[y] = make([]cellState, len(grid[y]))
+
+			for x := range grid[y] {
+				// Rolls removed in earlier waves are left as empty cells
+				switch {
+				case grid[y][x] != partTwoRule.occupied:
+					frame[y][x] = emptyCell
+				case fellInWave[y][x] == waveNum:
+					frame[y][x] = removingRoll
+				case fellInWave[y][x] == 0 || fellInWave[y][x] > waveNum:
+					frame[y][x] = stableRoll
+				}
+			}
+		}
+
+		frames = append(frames, frame)
+	}
+
+	return frames
+}
+
+// writeWaveGIF writes the frames as an animated GIF, drawing every cell as a
+// cellSize square and showing every frame for delay hundredths of a second.
+// The last frame is held for longer before the animation loops.
+func writeWaveGIF(path string, frames [][][]cellState, cellSize int, delay int) error {
+	animation := &gif.GIF{}
+
+	for i, frame := range frames {
+		width := 0
+		for y := range frame {
+			width = max(width, len(frame[y]))
+		}
+
+		img := image.NewPaletted(image.Rect(0, 0, width*cellSize, len(frame)*cellSize), framePalette)
+
+		for y := range frame {
+			for x, state := range frame[y] {
+				for py := y * cellSize; py < (y+1)*cellSize; py++ {
+					for px := x * cellSize; px < (x+1)*cellSize; px++ {
+						img.SetColorIndex(px, py, uint8(state))
+					}
+				}
+			}
+		}
+
+		frameDelay := delay
+		if i == len(frames)-1 {
+			frameDelay = delay * 5
+		}
+
+		animation.Image = append(animation.Image, img)
+		animation.Delay = append(animation.Delay, frameDelay)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := gif.EncodeAll(f, animation); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// playWaves redraws the room in the terminal for every frame, with rolls
+// about to be removed in red and stable rolls in white
+func playWaves(frames [][][]cellState, delay int) {
+	for i, frame := range frames {
+		var sb strings.Builder
+
+		// Move the cursor home and clear the screen before drawing
+		sb.WriteString("\033[H\033[2J")
+
+		for y := range frame {
+			for _, state := range frame[y] {
+				switch state {
+				case emptyCell:
+					sb.WriteByte(partTwoRule.empty)
+				case stableRoll:
+					sb.WriteString("\033[37m" + string(partTwoRule.occupied) + "\033[0m")
+				case removingRoll:
+					sb.WriteString("\033[1;31m" + string(partTwoRule.occupied) + "\033[0m")
+				}
+			}
+			sb.WriteByte('\n')
+		}
+
+		if i < len(frames)-1 {
+			fmt.Fprintf(&sb, "Wave %d of %d\n", i+1, len(frames)-1)
+		} else {
+			sb.WriteString("Done\n")
+		}
+
+		fmt.Print(sb.String())
+		time.Sleep(time.Duration(delay) * 10 * time.Millisecond)
+	}
+}
@@ -2,9 +2,12 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -15,99 +18,169 @@ type freshRange struct {
 	rangeEnd   int
 }
 
-func main() {
-	path := filepath.Join("inputs/day05.txt")
-	f, err := os.Open(path)
-	if err != nil {
-		panic(err)
+// mergeFreshRanges sorts the fresh ranges and merges them in a single sweep,
+// giving non-overlapping ranges in ascending order. Each range either extends
+// the last merged range, if it starts inside it, or starts a new one. With
+// mergeAdjacent set, a range starting right after the last merged range ends
+// (e.g. 3-5 and 6-8) is also joined onto it.
+func mergeFreshRanges(freshRanges []freshRange, mergeAdjacent bool) []freshRange {
+	sortedRanges := slices.Clone(freshRanges)
+	sort.Slice(sortedRanges, func(i, j int) bool {
+		return sortedRanges[i].rangeStart < sortedRanges[j].rangeStart
+	})
+
+	freshRangesNoOverlaps := []freshRange{}
+
+	for _, r := range sortedRanges {
+		if len(freshRangesNoOverlaps) > 0 {
+			last := &freshRangesNoOverlaps[len(freshRangesNoOverlaps)-1]
+
+			if r.rangeStart <= last.rangeEnd || (mergeAdjacent && r.rangeStart == last.rangeEnd+1) {
+				last.rangeEnd = max(last.rangeEnd, r.rangeEnd)
+				continue
+			}
+		}
+
+		freshRangesNoOverlaps = append(freshRangesNoOverlaps, r)
 	}
 
-	defer f.Close()
+	return freshRangesNoOverlaps
+}
 
-	sc := bufio.NewScanner(f)
+// isFresh checks whether an ingredient ID falls in any of the merged ranges by
+// binary searching for the first range that ends at or after it
+func isFresh(mergedRanges []freshRange, ingredientID int) bool {
+	i := sort.Search(len(mergedRanges), func(i int) bool {
+		return mergedRanges[i].rangeEnd >= ingredientID
+	})
 
-	freshRanges := []freshRange{}
+	return i < len(mergedRanges) && mergedRanges[i].rangeStart <= ingredientID
+}
 
-	// Get ranges first until the newline break
-	for sc.Scan() {
-		line := sc.Text()
+// streamQueries answers whether each ingredient ID read from r is fresh or
+// spoiled, one line at a time, so the IDs never need to be held in memory
+func streamQueries(mergedRanges []freshRange, r io.Reader, w io.Writer) {
+	sc := bufio.NewScanner(r)
+	out := bufio.NewWriter(w)
 
-		if len(line) == 0 {
-			break
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
 		}
 
-		currentRange := strings.Split(line, "-")
-
-		rangeStart, err := strconv.Atoi(currentRange[0])
+		ingredientID, err := strconv.Atoi(line)
 		if err != nil {
 			panic(err)
 		}
-		rangeEnd, err := strconv.Atoi(currentRange[1])
-		if err != nil {
+
+		if isFresh(mergedRanges, ingredientID) {
+			fmt.Fprintf(out, "%d fresh\n", ingredientID)
+		} else {
+			fmt.Fprintf(out, "%d spoiled\n", ingredientID)
+		}
+
+		if err := out.Flush(); err != nil {
 			panic(err)
 		}
+	}
 
-		freshRanges = append(freshRanges, freshRange{
-			rangeStart: rangeStart,
-			rangeEnd:   rangeEnd,
-		})
+	if err := sc.Err(); err != nil {
+		panic(err)
 	}
+}
 
-	freshCount := 0
+// readFreshRanges reads ranges from sc until the blank line that separates
+// them from the ingredient IDs
+func readFreshRanges(sc *bufio.Scanner) []freshRange {
+	freshRanges := []freshRange{}
 
-	// Then evaluate ingredient IDs against all of the ranges
 	for sc.Scan() {
-		ingredientID, err := strconv.Atoi(sc.Text())
-		if err != nil {
-			panic(err)
-		}
+		line := sc.Text()
 
-		for _, freshRange := range freshRanges {
-			if ingredientID >= freshRange.rangeStart && ingredientID <= freshRange.rangeEnd {
-				freshCount++
-				break
-			}
+		if len(line) == 0 {
+			break
 		}
+
+		freshRanges = append(freshRanges, parseRange(line))
 	}
 
-	// Part 2: Sort the freshRanges first
-	sort.Slice(freshRanges, func(i, j int) bool {
-		return freshRanges[i].rangeStart < freshRanges[j].rangeStart
-	})
+	return freshRanges
+}
 
-	freshRangesNoOverlaps := []freshRange{}
+// readRangeFile reads the fresh ranges from another inventory file
+func readRangeFile(path string) []freshRange {
+	f, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
 
-	// Gradually build a new slice of non-overlapping ranges
-	for i, _ := range freshRanges {
-		if i == 0 {
-			freshRangesNoOverlaps = append(freshRangesNoOverlaps, freshRanges[0])
-			continue
-		}
+	defer f.Close()
 
-		noOverlapLen := len(freshRangesNoOverlaps)
+	return readFreshRanges(bufio.NewScanner(f))
+}
 
-		overlapFound := false
+func main() {
+	stream := flag.Bool("stream", false, "read ingredient IDs from stdin and report whether each one is fresh")
+	complement := flag.String("complement", "", "print the spoiled ID ranges within this start-end bound")
+	intersect := flag.String("intersect", "", "print the ranges fresh in both this file and the input")
+	difference := flag.String("difference", "", "print the ranges fresh in the input but not in this file")
+	mergeAdjacent := flag.Bool("merge-adjacent", false, "merge ranges that touch (e.g. 3-5 and 6-8) as well as ranges that overlap")
+	overlaps := flag.Bool("overlaps", false, "print the IDs covered by more than one range and how many ranges cover them")
+	flag.Parse()
 
-		// (e.g. existing range 3-6, new range 2-5, replace start, new range 2-6)
-		if freshRanges[i].rangeStart <= freshRangesNoOverlaps[noOverlapLen-1].rangeStart && freshRanges[i].rangeEnd >= freshRangesNoOverlaps[noOverlapLen-1].rangeStart && freshRanges[i].rangeEnd <= freshRangesNoOverlaps[noOverlapLen-1].rangeEnd {
-			overlapFound = true
-			freshRangesNoOverlaps[noOverlapLen-1].rangeStart = freshRanges[i].rangeStart
-		}
+	path := filepath.Join("inputs/day05.txt")
+	f, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
 
-		// (e.g. existing range 3-6, new range 4-8, replace end, new range 3-8)
-		if freshRanges[i].rangeEnd >= freshRangesNoOverlaps[noOverlapLen-1].rangeEnd && freshRanges[i].rangeStart >= freshRangesNoOverlaps[noOverlapLen-1].rangeStart && freshRanges[i].rangeStart <= freshRangesNoOverlaps[noOverlapLen-1].rangeEnd {
-			overlapFound = true
-			freshRangesNoOverlaps[noOverlapLen-1].rangeEnd = freshRanges[i].rangeEnd
+	// Get ranges first until the newline break
+	freshRanges := readFreshRanges(sc)
+
+	if *overlaps {
+		fmt.Println("IDs covered by more than one range:")
+		for _, overlap := range overlappingRanges(freshRanges) {
+			fmt.Printf("  %d-%d x%d\n", overlap.rangeStart, overlap.rangeEnd, overlap.count)
 		}
+	}
+
+	freshRangesNoOverlaps := mergeFreshRanges(freshRanges, *mergeAdjacent)
+
+	if *complement != "" {
+		printRanges("Spoiled IDs within "+*complement, complementRanges(freshRangesNoOverlaps, parseRange(*complement)))
+	}
+
+	if *intersect != "" {
+		otherRanges := mergeFreshRanges(readRangeFile(*intersect), *mergeAdjacent)
+		printRanges("Fresh in both", intersectRanges(freshRangesNoOverlaps, otherRanges))
+	}
 
-		// (e.g. existing range 3-6, new range 4-5, already covered by existing range, so skip)
-		if freshRanges[i].rangeStart >= freshRangesNoOverlaps[noOverlapLen-1].rangeStart && freshRanges[i].rangeStart <= freshRangesNoOverlaps[noOverlapLen-1].rangeEnd && freshRanges[i].rangeEnd >= freshRangesNoOverlaps[noOverlapLen-1].rangeStart && freshRanges[i].rangeEnd <= freshRangesNoOverlaps[noOverlapLen-1].rangeEnd {
-			overlapFound = true
+	if *difference != "" {
+		otherRanges := mergeFreshRanges(readRangeFile(*difference), *mergeAdjacent)
+		printRanges("Fresh only in the input", subtractRanges(freshRangesNoOverlaps, otherRanges))
+	}
+
+	if *stream {
+		streamQueries(freshRangesNoOverlaps, os.Stdin, os.Stdout)
+		return
+	}
+
+	freshCount := 0
+
+	// Then evaluate ingredient IDs against the merged ranges
+	for sc.Scan() {
+		ingredientID, err := strconv.Atoi(sc.Text())
+		if err != nil {
+			panic(err)
 		}
 
-		// Unique range, append to non-overlapping ranges
-		if !overlapFound {
-			freshRangesNoOverlaps = append(freshRangesNoOverlaps, freshRanges[i])
+		if isFresh(freshRangesNoOverlaps, ingredientID) {
+			freshCount++
 		}
 	}
 
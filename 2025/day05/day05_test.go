@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// TestMergeMatchesBruteForce merges random ranges both with and without
+// adjacency and checks the merged ranges against a set of every ID in the
+// original ranges
+func TestMergeMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+
+	for range 2000 {
+		freshRanges := make([]freshRange, 1+rng.Intn(20))
+		coveredIDs := map[int]bool{}
+
+		for i := range freshRanges {
+			rangeStart := rng.Intn(200)
+			freshRanges[i] = freshRange{rangeStart: rangeStart, rangeEnd: rangeStart + rng.Intn(20)}
+
+			for id := freshRanges[i].rangeStart; id <= freshRanges[i].rangeEnd; id++ {
+				coveredIDs[id] = true
+			}
+		}
+
+		for _, mergeAdjacent := range []bool{false, true} {
+			mergedRanges := mergeFreshRanges(freshRanges, mergeAdjacent)
+
+			mergedIDCount := 0
+			for i, r := range mergedRanges {
+				if i > 0 && r.rangeStart <= mergedRanges[i-1].rangeEnd {
+					t.Fatalf("ranges %v merged into overlapping ranges %v", freshRanges, mergedRanges)
+				}
+				if mergeAdjacent && i > 0 && r.rangeStart == mergedRanges[i-1].rangeEnd+1 {
+					t.Fatalf("ranges %v merged into adjacent ranges %v", freshRanges, mergedRanges)
+				}
+
+				mergedIDCount += r.rangeEnd - r.rangeStart + 1
+			}
+
+			if mergedIDCount != len(coveredIDs) {
+				t.Fatalf("ranges %v merged into %v covering %d IDs, not %d", freshRanges, mergedRanges, mergedIDCount, len(coveredIDs))
+			}
+
+			for id := -1; id <= 221; id++ {
+				if isFresh(mergedRanges, id) != coveredIDs[id] {
+					t.Fatalf("ranges %v merged into %v: ID %d fresh is %t", freshRanges, mergedRanges, id, !coveredIDs[id])
+				}
+			}
+		}
+	}
+}
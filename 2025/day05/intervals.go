@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rangeMultiplicity is a range of IDs that are all covered by the same
+// number of the original fresh ranges
+type rangeMultiplicity struct {
+	freshRange
+	count int
+}
+
+// parseRange reads a range written as start-end
+func parseRange(s string) freshRange {
+	currentRange := strings.Split(strings.TrimSpace(s), "-")
+	if len(currentRange) != 2 {
+		panic(fmt.Errorf("invalid range %q", s))
+	}
+
+	rangeStart, err := strconv.Atoi(currentRange[0])
+	if err != nil {
+		panic(err)
+	}
+	rangeEnd, err := strconv.Atoi(currentRange[1])
+	if err != nil {
+		panic(err)
+	}
+
+	return freshRange{rangeStart: rangeStart, rangeEnd: rangeEnd}
+}
+
+// complementRanges finds the spoiled IDs within bound, which are the gaps
+// between the merged fresh ranges
+func complementRanges(mergedRanges []freshRange, bound freshRange) []freshRange {
+	var gaps []freshRange
+	next := bound.rangeStart
+
+	for _, r := range mergedRanges {
+		if r.rangeEnd < next {
+			continue
+		}
+		if r.rangeStart > bound.rangeEnd {
+			break
+		}
+
+		if r.rangeStart > next {
+			gaps = append(gaps, freshRange{rangeStart: next, rangeEnd: r.rangeStart - 1})
+		}
+
+		next = r.rangeEnd + 1
+	}
+
+	if next <= bound.rangeEnd {
+		gaps = append(gaps, freshRange{rangeStart: next, rangeEnd: bound.rangeEnd})
+	}
+
+	return gaps
+}
+
+// intersectRanges finds the IDs covered by both sets of merged ranges by
+// walking through them together
+func intersectRanges(a, b []freshRange) []freshRange {
+	var intersection []freshRange
+
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		start := max(a[i].rangeStart, b[j].rangeStart)
+		end := min(a[i].rangeEnd, b[j].rangeEnd)
+
+		if start <= end {
+			intersection = append(intersection, freshRange{rangeStart: start, rangeEnd: end})
+		}
+
+		// Move past whichever range finishes first, since it can't overlap
+		// anything else in the other set
+		if a[i].rangeEnd < b[j].rangeEnd {
+			i++
+		} else {
+			j++
+		}
+	}
+
+	return intersection
+}
+
+// subtractRanges finds the IDs covered by the merged ranges in a but not b
+func subtractRanges(a, b []freshRange) []freshRange {
+	var difference []freshRange
+	j := 0
+
+	for _, r := range a {
+		next := r.rangeStart
+
+		// Skip the ranges in b that end before this range starts
+		for j < len(b) && b[j].rangeEnd < r.rangeStart {
+			j++
+		}
+
+		for k := j; k < len(b) && b[k].rangeStart <= r.rangeEnd; k++ {
+			if b[k].rangeStart > next {
+				difference = append(difference, freshRange{rangeStart: next, rangeEnd: b[k].rangeStart - 1})
+			}
+			next = max(next, b[k].rangeEnd+1)
+		}
+
+		if next <= r.rangeEnd {
+			difference = append(difference, freshRange{rangeStart: next, rangeEnd: r.rangeEnd})
+		}
+	}
+
+	return difference
+}
+
+// overlappingRanges finds the IDs covered by more than one of the original
+// ranges along with how many ranges cover them. It sweeps over the points
+// where each range starts and just after each one ends, keeping a count of
+// the ranges that are open.
+func overlappingRanges(freshRanges []freshRange) []rangeMultiplicity {
+	type event struct {
+		pos   int
+		delta int
+	}
+
+	events := make([]event, 0, len(freshRanges)*2)
+	for _, r := range freshRanges {
+		events = append(events, event{pos: r.rangeStart, delta: 1}, event{pos: r.rangeEnd + 1, delta: -1})
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].pos < events[j].pos
+	})
+
+	var overlaps []rangeMultiplicity
+	count := 0
+
+	for i := 0; i < len(events); {
+		pos := events[i].pos
+		for ; i < len(events) && events[i].pos == pos; i++ {
+			count += events[i].delta
+		}
+
+		if count < 2 || i == len(events) {
+			continue
+		}
+
+		// The count holds until the next event
+		end := events[i].pos - 1
+		last := len(overlaps) - 1
+		if last >= 0 && overlaps[last].count == count && overlaps[last].rangeEnd == pos-1 {
+			overlaps[last].rangeEnd = end
+		} else {
+			overlaps = append(overlaps, rangeMultiplicity{
+				freshRange: freshRange{rangeStart: pos, rangeEnd: end},
+				count:      count,
+			})
+		}
+	}
+
+	return overlaps
+}
+
+// printRanges prints sorted, non-overlapping ranges, joining any that touch
+// so that the same IDs are always printed as the same list
+func printRanges(title string, ranges []freshRange) {
+	fmt.Printf("%s:\n", title)
+	if len(ranges) == 0 {
+		fmt.Println("  none")
+		return
+	}
+
+	current := ranges[0]
+	for _, r := range ranges[1:] {
+		if r.rangeStart == current.rangeEnd+1 {
+			current.rangeEnd = r.rangeEnd
+			continue
+		}
+
+		fmt.Printf("  %d-%d\n", current.rangeStart, current.rangeEnd)
+		current = r
+	}
+
+	fmt.Printf("  %d-%d\n", current.rangeStart, current.rangeEnd)
+}
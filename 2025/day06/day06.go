@@ -2,33 +2,283 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
+	"math"
+	"math/big"
 	"os"
 	"path/filepath"
-	"slices"
 	"strconv"
 	"strings"
 )
 
-func transposeRuneOperands(matrix [][]rune) [][]rune {
-	rows := len(matrix)
-	cols := len(matrix[0])
+// operator describes how a worksheet problem combines its operands. Problems
+// are folded from left to right starting with the first operand, except for
+// right associative operators, which fold from the right.
+//
+// fold works on ints and returns errOverflow if the result doesn't fit, in
+// which case the problem is solved again with bigFold.
+type operator struct {
+	fold             func(acc, operand int) (int, error)
+	bigFold          func(acc, operand *big.Int) (*big.Int, error)
+	rightAssociative bool
+}
+
+var (
+	errDivideByZero = errors.New("division by zero")
+	errOverflow     = errors.New("integer overflow")
+)
+
+// maxExponentBits limits how large a big integer power can get before it is
+// treated as an error rather than left to use up all of the memory
+const maxExponentBits = 1 << 24
+
+func addInts(a, b int) (int, error) {
+	if (b > 0 && a > math.MaxInt-b) || (b < 0 && a < math.MinInt-b) {
+		return 0, errOverflow
+	}
+
+	return a + b, nil
+}
+
+func mulInts(a, b int) (int, error) {
+	if a == 0 || b == 0 {
+		return 0, nil
+	}
+
+	product := a * b
+	if product/b != a || (a == -1 && b == math.MinInt) || (b == -1 && a == math.MinInt) {
+		return 0, errOverflow
+	}
+
+	return product, nil
+}
+
+var operators = map[string]operator{
+	"+": {
+		fold: addInts,
+		bigFold: func(acc, operand *big.Int) (*big.Int, error) {
+			return new(big.Int).Add(acc, operand), nil
+		},
+	},
+	"*": {
+		fold: mulInts,
+		bigFold: func(acc, operand *big.Int) (*big.Int, error) {
+			return new(big.Int).Mul(acc, operand), nil
+		},
+	},
+	"-": {
+		fold: func(acc, operand int) (int, error) {
+			if operand == math.MinInt {
+				return 0, errOverflow
+			}
+			return addInts(acc, -operand)
+		},
+		bigFold: func(acc, operand *big.Int) (*big.Int, error) {
+			return new(big.Int).Sub(acc, operand), nil
+		},
+	},
+	"/": {
+		fold: func(acc, operand int) (int, error) {
+			if operand == 0 {
+				return 0, errDivideByZero
+			}
+			if acc == math.MinInt && operand == -1 {
+				return 0, errOverflow
+			}
+			return acc / operand, nil
+		},
+		bigFold: func(acc, operand *big.Int) (*big.Int, error) {
+			if operand.Sign() == 0 {
+				return nil, errDivideByZero
+			}
+			// Quo truncates towards zero like integer division does
+			return new(big.Int).Quo(acc, operand), nil
+		},
+	},
+	"%": {
+		fold: func(acc, operand int) (int, error) {
+			if operand == 0 {
+				return 0, errDivideByZero
+			}
+			return acc % operand, nil
+		},
+		bigFold: func(acc, operand *big.Int) (*big.Int, error) {
+			if operand.Sign() == 0 {
+				return nil, errDivideByZero
+			}
+			return new(big.Int).Rem(acc, operand), nil
+		},
+	},
+	"min": {
+		fold: func(acc, operand int) (int, error) { return min(acc, operand), nil },
+		bigFold: func(acc, operand *big.Int) (*big.Int, error) {
+			if operand.Cmp(acc) < 0 {
+				return operand, nil
+			}
+			return acc, nil
+		},
+	},
+	"max": {
+		fold: func(acc, operand int) (int, error) { return max(acc, operand), nil },
+		bigFold: func(acc, operand *big.Int) (*big.Int, error) {
+			if operand.Cmp(acc) > 0 {
+				return operand, nil
+			}
+			return acc, nil
+		},
+	},
+	"^": {
+		fold: func(acc, operand int) (int, error) {
+			if operand < 0 {
+				return 0, fmt.Errorf("negative exponent %d", operand)
+			}
+
+			// Powers of -1, 0 and 1 never grow, so don't multiply them out
+			switch {
+			case operand == 0:
+				return 1, nil
+			case acc == 0 || acc == 1:
+				return acc, nil
+			case acc == -1:
+				return 1 - 2*(operand%2), nil
+			}
+
+			result := 1
+			for range operand {
+				var err error
+				result, err = mulInts(result, acc)
+				if err != nil {
+					return 0, err
+				}
+			}
+			return result, nil
+		},
+		bigFold: func(acc, operand *big.Int) (*big.Int, error) {
+			if operand.Sign() < 0 {
+				return nil, fmt.Errorf("negative exponent %s", operand)
+			}
+
+			// The result has about acc.BitLen()*operand bits, which is checked
+			// by dividing so that it can't overflow
+			if acc.CmpAbs(big.NewInt(1)) > 0 && operand.Cmp(big.NewInt(maxExponentBits/int64(acc.BitLen()))) > 0 {
+				return nil, fmt.Errorf("%s^%s is too large", acc, operand)
+			}
+
+			return new(big.Int).Exp(acc, operand, nil), nil
+		},
+		rightAssociative: true,
+	},
+}
+
+// lookupOperator finds the operator for a symbol in the operator row
+func lookupOperator(symbol string) (operator, error) {
+	op, ok := operators[symbol]
+	if !ok {
+		return operator{}, fmt.Errorf("unknown operator %q", symbol)
+	}
+
+	return op, nil
+}
+
+// foldOperands folds the operands together in the operator's order using
+// the given fold
+func foldOperands[T any](op operator, operands []T, fold func(acc, operand T) (T, error)) (T, error) {
+	if op.rightAssociative {
+		result := operands[len(operands)-1]
+		for i := len(operands) - 2; i >= 0; i-- {
+			var err error
+			// The fold takes the accumulated value as its right hand side here
+			result, err = fold(operands[i], result)
+			if err != nil {
+				return result, err
+			}
+		}
+		return result, nil
+	}
+
+	result := operands[0]
+	for _, operand := range operands[1:] {
+		var err error
+		result, err = fold(result, operand)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
 
-	result := make([][]rune, cols)
-	for i := range result {
-		result[i] = make([]rune, rows)
+// solve folds the operands of a problem together with the operator. It tries
+// the fast int path first and falls back to big integers if any operand or
+// intermediate result doesn't fit in an int, reporting when it had to.
+func (op operator) solve(operands []*big.Int) (*big.Int, bool, error) {
+	if len(operands) == 0 {
+		return nil, false, errors.New("problem has no operands")
 	}
 
-	for i := 0; i < rows; i++ {
-		for j := 0; j < cols; j++ {
-			result[j][i] = matrix[i][j]
+	intOperands := make([]int, 0, len(operands))
+	for _, operand := range operands {
+		if !operand.IsInt64() || operand.Int64() < math.MinInt || operand.Int64() > math.MaxInt {
+			break
 		}
+		intOperands = append(intOperands, int(operand.Int64()))
 	}
 
-	return result
+	if len(intOperands) == len(operands) {
+		result, err := foldOperands(op, intOperands, op.fold)
+		if err == nil {
+			return big.NewInt(int64(result)), false, nil
+		}
+		if !errors.Is(err, errOverflow) {
+			return nil, false, err
+		}
+	}
+
+	result, err := foldOperands(op, operands, op.bigFold)
+	if err != nil {
+		return nil, true, err
+	}
+
+	return result, true, nil
+}
+
+// parseOperand reads an operand of any size
+func parseOperand(s string) (*big.Int, bool) {
+	return new(big.Int).SetString(s, 10)
+}
+
+// isOperatorRow reports whether a line of the worksheet holds the operators,
+// which is the first line with a field that isn't a number
+func isOperatorRow(lineFields []string) bool {
+	for _, field := range lineFields {
+		if _, ok := parseOperand(field); !ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// printFallbacks lists the problems that were too large for the int path
+func printFallbacks(part string, problems []int) {
+	if len(problems) == 0 {
+		return
+	}
+
+	problemNums := make([]string, len(problems))
+	for i, p := range problems {
+		problemNums[i] = strconv.Itoa(p)
+	}
+
+	fmt.Printf("%s problems that overflowed int64 and used big integers: %s\n", part, strings.Join(problemNums, ", "))
 }
 
 func main() {
+	breakdown := flag.Bool("breakdown", false, "print each problem's operands, operator and result for both parts")
+	flag.Parse()
+
 	path := filepath.Join("inputs/day06.txt")
 	f, err := os.Open(path)
 	if err != nil {
@@ -39,113 +289,71 @@ func main() {
 
 	sc := bufio.NewScanner(f)
 
-	runeOperands := [][]rune{}
-	operands := [][]int{}
-	operators := []string{}
+	operandRows := [][]rune{}
+	operatorRow := ""
 
 	for sc.Scan() {
 		line := sc.Text()
-		lineFields := strings.Fields(line)
 
-		if slices.Contains(lineFields, "+") || slices.Contains(lineFields, "*") {
-			operators = lineFields
+		if isOperatorRow(strings.Fields(line)) {
+			operatorRow = line
 			break
 		}
 
-		runeLine := []rune(line)
-		slices.Reverse(runeLine)
-		runeOperands = append(runeOperands, []rune(runeLine))
-
-		intLineOperands := []int{}
-
-		for _, operand := range lineFields {
-			intOperand, err := strconv.Atoi(operand)
-			if err != nil {
-				panic(err)
-			}
-			intLineOperands = append(intLineOperands, intOperand)
-		}
-
-		operands = append(operands, intLineOperands)
-	}
-
-	// verticalTotals will hold the sum or product of the operands in each column
-	verticalTotals := make([]int, len(operands[0]), len(operands[0]))
-
-	for i := 0; i < len(operands); i++ {
-		for j := 0; j < len(operands[i]); j++ {
-			if operators[j] == "+" {
-				if i == 0 {
-					verticalTotals[j] = operands[i][j]
-				} else {
-					verticalTotals[j] += operands[i][j]
-				}
-			} else if operators[j] == "*" {
-				if i == 0 {
-					verticalTotals[j] = operands[i][j]
-				} else {
-					verticalTotals[j] *= operands[i][j]
-				}
-			}
-		}
+		operandRows = append(operandRows, []rune(line))
 	}
 
-	var partOneTotal int
-	for _, v := range verticalTotals {
-		partOneTotal += v
+	problems, err := findProblems(operandRows, operatorRow)
+	if err != nil {
+		panic(err)
 	}
 
-	// In Part Two, the columns are read from right-to-left in columns
-	// So we need to transpose the operands and operators to make them readable left-to-right
-	runeOperands = transposeRuneOperands(runeOperands)
-	slices.Reverse(operators)
+	partOneTotal := new(big.Int)
+	partTwoTotal := new(big.Int)
+	var partOneFallbacks, partTwoFallbacks []int
 
-	reverseCol := 0
-	isFirstValue := true
-	columnSum := 0
-	partTwoTotal := 0
+	for i, p := range problems {
+		// In Part One the operands are read across the rows, and in Part Two
+		// they are read down the character columns from right to left
+		rowOperands, err := p.rowOperands(operandRows)
+		if err != nil {
+			panic(fmt.Errorf("part one problem %d: %w", i+1, err))
+		}
 
-	for i := range runeOperands {
-		reversedOperand := string(runeOperands[i])
-		cleanedOperand := strings.ReplaceAll(reversedOperand, " ", "")
+		columnOperands, err := p.columnOperands(operandRows)
+		if err != nil {
+			panic(fmt.Errorf("part two problem %d: %w", i+1, err))
+		}
 
-		var intReversedOperand int
-		if cleanedOperand != "" {
-			var err error
-			intReversedOperand, err = strconv.Atoi(cleanedOperand)
-			if err != nil {
-				panic(err)
-			}
+		partOneResult, fellBack, err := p.op.solve(rowOperands)
+		if err != nil {
+			panic(fmt.Errorf("part one problem %d (%s): %w", i+1, p.symbol, err))
+		}
+		if fellBack {
+			partOneFallbacks = append(partOneFallbacks, i+1)
 		}
 
-		if intReversedOperand != 0 {
-			if i == len(runeOperands)-1 {
-				if operators[reverseCol] == "+" {
-					columnSum += intReversedOperand
-				} else if operators[reverseCol] == "*" {
-					columnSum *= intReversedOperand
-				}
+		partTwoResult, fellBack, err := p.op.solve(columnOperands)
+		if err != nil {
+			panic(fmt.Errorf("part two problem %d (%s): %w", i+1, p.symbol, err))
+		}
+		if fellBack {
+			partTwoFallbacks = append(partTwoFallbacks, i+1)
+		}
 
-				partTwoTotal += columnSum
-				break
-			}
+		partOneTotal.Add(partOneTotal, partOneResult)
+		partTwoTotal.Add(partTwoTotal, partTwoResult)
 
-			if isFirstValue == true {
-				columnSum = intReversedOperand
-				isFirstValue = false
-			} else if operators[reverseCol] == "+" {
-				columnSum += intReversedOperand
-			} else if operators[reverseCol] == "*" {
-				columnSum *= intReversedOperand
-			}
-		} else {
-			partTwoTotal += columnSum
-			columnSum = 0
-			isFirstValue = true
-			reverseCol++
+		if *breakdown {
+			fmt.Printf("Problem %d (columns %d-%d, %s)\n", i+1, p.start+1, p.end, p.symbol)
+			fmt.Printf("  part one: %s\n", formatProblem(p.symbol, rowOperands, partOneResult))
+			fmt.Printf("  part two: %s\n", formatProblem(p.symbol, columnOperands, partTwoResult))
 		}
 	}
 
-	fmt.Printf("Part one grand total: %d\n", partOneTotal)
-	fmt.Printf("Part two grand total: %d\n", partTwoTotal)
+	fmt.Printf("Part one grand total: %s\n", partOneTotal)
+	fmt.Printf("Part two grand total: %s\n", partTwoTotal)
+
+	printFallbacks("Part one", partOneFallbacks)
+	printFallbacks("Part two", partTwoFallbacks)
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func bigInts(t *testing.T, values ...string) []*big.Int {
+	t.Helper()
+
+	ints := make([]*big.Int, len(values))
+	for i, v := range values {
+		var ok bool
+		if ints[i], ok = parseOperand(v); !ok {
+			t.Fatalf("invalid operand %q", v)
+		}
+	}
+
+	return ints
+}
+
+func TestExponent(t *testing.T) {
+	tests := []struct {
+		operands []string
+		want     string
+		fellBack bool
+	}{
+		{operands: []string{"2", "10"}, want: "1024"},
+		// Exponents fold from the right, so this is 2^(3^2)
+		{operands: []string{"2", "3", "2"}, want: "512"},
+		{operands: []string{"-1", "9223372036854775807"}, want: "-1"},
+		{operands: []string{"2", "100"}, want: "1267650600228229401496703205376", fellBack: true},
+	}
+
+	for _, tt := range tests {
+		got, fellBack, err := operators["^"].solve(bigInts(t, tt.operands...))
+		if err != nil {
+			t.Fatalf("%s: %v", strings.Join(tt.operands, "^"), err)
+		}
+		if got.String() != tt.want || fellBack != tt.fellBack {
+			t.Errorf("%s = %s (fell back %t), want %s (fell back %t)", strings.Join(tt.operands, "^"), got, fellBack, tt.want, tt.fellBack)
+		}
+	}
+}
+
+// TestExponentTooLarge checks that powers too large to hold are rejected,
+// including exponents so large that the number of bits in the result doesn't
+// fit in an int64
+func TestExponentTooLarge(t *testing.T) {
+	for _, operands := range [][]string{
+		{"2", "9223372036854775807"},
+		{"3", "4611686018427387904"},
+		{"2", "100000000000000000000"},
+		{"2", "16777217"},
+	} {
+		_, _, err := operators["^"].solve(bigInts(t, operands...))
+		if err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("%s gave error %v, want it to be too large", strings.Join(operands, "^"), err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+// problem is one problem on the worksheet, which takes up the character
+// columns from start up to but not including end
+type problem struct {
+	start  int
+	end    int
+	symbol string
+	op     operator
+}
+
+// cellAt returns the character at col, treating anything past the end of a
+// short line as a space
+func cellAt(row []rune, col int) rune {
+	if col < len(row) {
+		return row[col]
+	}
+
+	return ' '
+}
+
+// isBlankColumn reports whether a character column is a space in every row
+func isBlankColumn(rows [][]rune, col int) bool {
+	for _, row := range rows {
+		if !unicode.IsSpace(cellAt(row, col)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// findProblems splits the worksheet into problems at the character columns
+// that are blank in every operand row, and then pairs each problem with an
+// operator from the operator row. The operators are paired in order, so they
+// don't have to line up with their problems exactly.
+func findProblems(rows [][]rune, operatorRow string) ([]problem, error) {
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+
+	var problems []problem
+	start := -1
+
+	for col := 0; col <= width; col++ {
+		blank := col == width || isBlankColumn(rows, col)
+
+		if !blank && start == -1 {
+			start = col
+		}
+
+		if blank && start != -1 {
+			problems = append(problems, problem{start: start, end: col})
+			start = -1
+		}
+	}
+
+	symbols := strings.Fields(operatorRow)
+	if len(symbols) != len(problems) {
+		return nil, fmt.Errorf("found %d operators for %d problems", len(symbols), len(problems))
+	}
+
+	for i, symbol := range symbols {
+		op, err := lookupOperator(symbol)
+		if err != nil {
+			return nil, fmt.Errorf("problem %d: %w", i+1, err)
+		}
+
+		problems[i].symbol = symbol
+		problems[i].op = op
+	}
+
+	return problems, nil
+}
+
+// rowOperands reads the problem's operands the way part one does, with one
+// operand in each row
+func (p problem) rowOperands(rows [][]rune) ([]*big.Int, error) {
+	var operands []*big.Int
+
+	for _, row := range rows {
+		var cell strings.Builder
+		for col := p.start; col < p.end; col++ {
+			cell.WriteRune(cellAt(row, col))
+		}
+
+		field := strings.TrimSpace(cell.String())
+		if field == "" {
+			continue
+		}
+
+		operand, ok := parseOperand(field)
+		if !ok {
+			return nil, fmt.Errorf("invalid operand %q", field)
+		}
+		operands = append(operands, operand)
+	}
+
+	return operands, nil
+}
+
+// columnOperands reads the problem's operands the way part two does, with one
+// operand in each character column read from right to left, and the digits of
+// each operand read from top to bottom
+func (p problem) columnOperands(rows [][]rune) ([]*big.Int, error) {
+	var operands []*big.Int
+
+	for col := p.end - 1; col >= p.start; col-- {
+		var digits strings.Builder
+		for _, row := range rows {
+			if c := cellAt(row, col); !unicode.IsSpace(c) {
+				digits.WriteRune(c)
+			}
+		}
+
+		if digits.Len() == 0 {
+			continue
+		}
+
+		operand, ok := parseOperand(digits.String())
+		if !ok {
+			return nil, fmt.Errorf("invalid operand %q", digits.String())
+		}
+		operands = append(operands, operand)
+	}
+
+	return operands, nil
+}
+
+// formatProblem writes out a problem's operands joined by its operator
+func formatProblem(symbol string, operands []*big.Int, result *big.Int) string {
+	terms := make([]string, len(operands))
+	for i, operand := range operands {
+		terms[i] = operand.String()
+	}
+
+	return fmt.Sprintf("%s = %s", strings.Join(terms, " "+symbol+" "), result)
+}
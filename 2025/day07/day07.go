@@ -2,47 +2,449 @@ package main
 
 import (
 	"bufio"
+	"encoding/csv"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 )
 
-type Room map[int]map[int]rune
+// beamSource is a point where a beam enters the manifold, heading down. A
+// source on row -1 is injected from above the top row.
+type beamSource struct {
+	row int
+	col int
+}
+
+// Manifold holds the tachyon manifold as a dense grid of rows, with shorter
+// rows padded out with empty space, along with the table of elements its
+// cells are drawn from
+type Manifold struct {
+	cells    [][]byte
+	width    int
+	sources  []beamSource
+	elements map[byte]element
+
+	// downward is set when every element in the manifold keeps a beam that
+	// is travelling down moving down, so the beams can be followed a row at
+	// a time in O(width) memory instead of through every beam state
+	downward bool
+}
+
+// parseManifold reads the manifold grid and finds every beam source in it.
+// Every cell has to be one of the given elements.
+func parseManifold(sc *bufio.Scanner, elements map[byte]element) (Manifold, error) {
+	m := Manifold{elements: elements}
+
+	for row := 0; sc.Scan(); row++ {
+		line := []byte(sc.Text())
+
+		for col, c := range line {
+			if _, ok := elements[c]; !ok {
+				return Manifold{}, fmt.Errorf("unknown element %q at row %d column %d", c, row, col)
+			}
+
+			if c == 'S' {
+				m.sources = append(m.sources, beamSource{row: row, col: col})
+			}
+		}
+
+		m.cells = append(m.cells, line)
+		m.width = max(m.width, len(line))
+	}
+
+	if err := sc.Err(); err != nil {
+		return Manifold{}, err
+	}
+
+	for row := range m.cells {
+		for len(m.cells[row]) < m.width {
+			m.cells[row] = append(m.cells[row], '.')
+		}
+	}
+
+	keepsDown := map[byte]bool{}
+	for c, e := range elements {
+		keepsDown[c] = e.keepsDown()
+	}
+
+	m.downward = true
+	for _, row := range m.cells {
+		for _, c := range row {
+			m.downward = m.downward && keepsDown[c]
+		}
+	}
+
+	return m, nil
+}
+
+// inject adds sources that enter the top row of the manifold at each column
+func (m *Manifold) inject(cols []int) error {
+	for _, col := range cols {
+		if col < 0 || col >= m.width {
+			return fmt.Errorf("injection column %d is outside the manifold", col)
+		}
+
+		m.sources = append(m.sources, beamSource{row: -1, col: col})
+	}
+
+	return nil
+}
+
+// A beam state is a beam in one cell travelling in one direction, numbered so
+// that every state in the manifold fits in one slice
+func (m Manifold) numStates() int {
+	return len(m.cells) * m.width * int(numDirections)
+}
+
+func (m Manifold) stateID(row, col int, dir direction) int {
+	return (row*m.width+col)*int(numDirections) + int(dir)
+}
+
+func (m Manifold) stateAt(id int) (row, col int, dir direction) {
+	dir = direction(id % int(numDirections))
+	cell := id / int(numDirections)
+
+	return cell / m.width, cell % m.width, dir
+}
+
+// start is the state a source's beam begins in. A source's own cell passes
+// its beam straight down, and an injected beam enters the top row.
+func (m Manifold) start(source beamSource) int {
+	return m.stateID(max(source.row, 0), source.col, down)
+}
+
+func (m Manifold) starts(sources []beamSource) []int {
+	ids := make([]int, len(sources))
+	for i, source := range sources {
+		ids[i] = m.start(source)
+	}
+
+	return ids
+}
+
+// beamMove is where one of the beams leaving a state goes. It either moves on
+// to the next state, leaves through the bottom of the manifold at exitCol, or
+// is lost through the top or sides with both set to -1.
+type beamMove struct {
+	next    int
+	exitCol int
+}
+
+// moves finds where each of the beams leaving a state goes, in the same order
+// as the steps of the element it is in
+func (m Manifold) moves(id int) []beamMove {
+	row, col, dir := m.stateAt(id)
+
+	steps := m.elements[m.cells[row][col]].exits(dir)
+	moves := make([]beamMove, len(steps))
+
+	for i, s := range steps {
+		r, c := row+s.row, col+s.col
+		moves[i] = beamMove{next: -1, exitCol: -1}
+
+		switch {
+		case c < 0 || c >= m.width || r < 0:
+		case r == len(m.cells):
+			moves[i].exitCol = c
+		case r < len(m.cells):
+			moves[i].next = m.stateID(r, c, s.dir)
+		}
+	}
+
+	return moves
+}
+
+// nextStates finds the states the beams leaving a state move on to
+func (m Manifold) nextStates(id int) []int {
+	var next []int
+	for _, move := range m.moves(id) {
+		if move.next != -1 {
+			next = append(next, move.next)
+		}
+	}
+
+	return next
+}
+
+// traverse finds every state that the beams from starts can reach, ordered so
+// that each state comes before every state its beam moves on to. It walks
+// the states depth first with its own stack rather than recursing, so tall
+// manifolds can't run it out of stack. If the beams can go round in a loop,
+// loop is one of the states on it, and otherwise it is -1.
+func (m Manifold) traverse(starts []int) (order []int, loop int) {
+	const (
+		unvisited = iota
+		onStack
+		finished
+	)
+
+	type frame struct {
+		id   int
+		next []int
+	}
+
+	visited := make([]uint8, m.numStates())
+	loop = -1
+
+	for _, start := range starts {
+		if visited[start] != unvisited {
+			continue
+		}
+
+		visited[start] = onStack
+		stack := []frame{{id: start, next: m.nextStates(start)}}
+
+		for len(stack) > 0 {
+			top := len(stack) - 1
+
+			if len(stack[top].next) == 0 {
+				visited[stack[top].id] = finished
+				order = append(order, stack[top].id)
+				stack = stack[:top]
+				continue
+			}
+
+			id := stack[top].next[0]
+			stack[top].next = stack[top].next[1:]
+
+			switch visited[id] {
+			case unvisited:
+				visited[id] = onStack
+				stack = append(stack, frame{id: id, next: m.nextStates(id)})
+			case onStack:
+				if loop == -1 {
+					loop = id
+				}
+			}
+		}
+	}
+
+	// The states were finished after everything they lead to
+	slices.Reverse(order)
+
+	return order, loop
+}
+
+// loopError describes where the beams go round in a loop
+func (m Manifold) loopError(loop int) error {
+	row, col, _ := m.stateAt(loop)
+	return fmt.Errorf("beams loop forever through row %d column %d", row, col)
+}
+
+// visitSplits calls visit once for every cell where a beam from the sources
+// is split. Beams that meet in the same cell travelling the same way merge
+// into one, so each splitter is only visited once however many beams reach
+// it.
+func (m Manifold) visitSplits(sources []beamSource, visit func(row, col int)) {
+	if m.downward {
+		m.visitSplitsByRow(sources, visit)
+		return
+	}
 
-var calculatedPositions = make(map[int]map[int]int)
+	visited := make([][]bool, len(m.cells))
+	for row := range visited {
+		visited[row] = make([]bool, m.width)
+	}
 
-func (r Room) countTimelines(row, col int) int {
-	if row < 0 || row >= len(r) {
-		return 0
+	order, _ := m.traverse(m.starts(sources))
+	for _, id := range order {
+		row, col, dir := m.stateAt(id)
+		if m.elements[m.cells[row][col]].splits(dir) && !visited[row][col] {
+			visited[row][col] = true
+			visit(row, col)
+		}
 	}
+}
 
-	if row == len(r)-1 {
-		return 1
+// activatedSplitters marks every cell where a beam from the sources is split
+func (m Manifold) activatedSplitters(sources []beamSource) [][]bool {
+	activated := make([][]bool, len(m.cells))
+	for row := range activated {
+		activated[row] = make([]bool, m.width)
 	}
 
-	var count int
+	m.visitSplits(sources, func(row, col int) {
+		activated[row][col] = true
+	})
+
+	return activated
+}
 
-	if _, ok := calculatedPositions[row]; !ok {
-		calculatedPositions[row] = make(map[int]int)
+// countSplits counts every splitter that a beam from the sources reaches
+func (m Manifold) countSplits(sources []beamSource) int {
+	splits := 0
+	m.visitSplits(sources, func(int, int) {
+		splits++
+	})
+
+	return splits
+}
+
+// countTimelines counts the timelines a single particle can take from each
+// source out of the bottom of the manifold, where every splitter sends it
+// down every one of its branches. It works back from the states closest to
+// the exits, so each state's timelines are the sum of the timelines from the
+// states it moves on to. If the beams can loop there would be no end to the
+// timelines, so that is an error.
+func (m Manifold) countTimelines() ([]int, error) {
+	if m.downward {
+		return m.countTimelinesByRow(), nil
 	}
 
-	if r[row][col] == '^' {
-		if _, ok := calculatedPositions[row][col]; ok {
-			count += calculatedPositions[row][col]
-		} else {
-			count += r.countTimelines(row+1, col-1) + r.countTimelines(row+1, col+1)
+	starts := m.starts(m.sources)
+
+	order, loop := m.traverse(starts)
+	if loop != -1 {
+		return nil, m.loopError(loop)
+	}
+
+	timelines := make([]int, m.numStates())
+
+	for i := len(order) - 1; i >= 0; i-- {
+		for _, move := range m.moves(order[i]) {
+			switch {
+			case move.exitCol != -1:
+				timelines[order[i]]++
+			case move.next != -1:
+				timelines[order[i]] += timelines[move.next]
+			}
 		}
 	}
 
-	if r[row][col] == '.' || r[row][col] == 'S' {
-		count += r.countTimelines(row+1, col)
+	sourceTimelines := make([]int, len(starts))
+	for i, start := range starts {
+		sourceTimelines[i] = timelines[start]
 	}
 
-	calculatedPositions[row][col] = count
-	return count
+	return sourceTimelines, nil
+}
+
+// beamCounts counts how many timelines from all of the sources leave the
+// bottom of the manifold in each column, and with withCells set how many pass
+// through each cell of the manifold. It follows the timelines forwards from
+// the sources, which gives the same total as countTimelines worked out from
+// the other end.
+func (m Manifold) beamCounts(withCells bool) (cellCounts [][]int, exitCounts []int, err error) {
+	if withCells {
+		cellCounts = make([][]int, len(m.cells))
+		for row := range cellCounts {
+			cellCounts[row] = make([]int, m.width)
+		}
+	}
+
+	if m.downward {
+		exitCounts = m.flowByRow(func(row int, counts []int) {
+			if withCells {
+				copy(cellCounts[row], counts)
+			}
+		})
+
+		return cellCounts, exitCounts, nil
+	}
+
+	starts := m.starts(m.sources)
+
+	order, loop := m.traverse(starts)
+	if loop != -1 {
+		return nil, nil, m.loopError(loop)
+	}
+
+	timelines := make([]int, m.numStates())
+	for _, start := range starts {
+		timelines[start]++
+	}
+
+	exitCounts = make([]int, m.width)
+
+	for _, id := range order {
+		if withCells {
+			row, col, _ := m.stateAt(id)
+			cellCounts[row][col] += timelines[id]
+		}
+
+		for _, move := range m.moves(id) {
+			switch {
+			case move.exitCol != -1:
+				exitCounts[move.exitCol] += timelines[id]
+			case move.next != -1:
+				timelines[move.next] += timelines[id]
+			}
+		}
+	}
+
+	return cellCounts, exitCounts, nil
+}
+
+// printExitReport prints how many timelines leave the manifold in each
+// bottom row column, followed by the splitters activated and timelines
+// started by each source, either as aligned tables or as CSV
+func printExitReport(m Manifold, exitCounts []int, sourceTimelines []int, asCSV bool) {
+	exitRows := [][]string{{"exit column", "timelines"}}
+	for col, count := range exitCounts {
+		if count > 0 {
+			exitRows = append(exitRows, []string{strconv.Itoa(col), strconv.Itoa(count)})
+		}
+	}
+
+	sourceRows := [][]string{{"source", "row", "column", "splitters", "timelines"}}
+	for i, source := range m.sources {
+		sourceRows = append(sourceRows, []string{
+			strconv.Itoa(i + 1),
+			strconv.Itoa(source.row),
+			strconv.Itoa(source.col),
+			strconv.Itoa(m.countSplits([]beamSource{source})),
+			strconv.Itoa(sourceTimelines[i]),
+		})
+	}
+
+	for i, rows := range [][][]string{exitRows, sourceRows} {
+		if i > 0 {
+			fmt.Println()
+		}
+
+		if asCSV {
+			w := csv.NewWriter(os.Stdout)
+			if err := w.WriteAll(rows); err != nil {
+				panic(err)
+			}
+			continue
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+		}
+		if err := tw.Flush(); err != nil {
+			panic(err)
+		}
+	}
 }
 
 func main() {
+	injectCols := flag.String("inject", "", "comma separated columns to inject beams into from above the top row")
+	report := flag.Bool("report", false, "print the timelines leaving each bottom row column and the splitters each source activates")
+	asCSV := flag.Bool("csv", false, "print the report as CSV")
+	render := flag.Bool("render", false, "draw the beam paths through the manifold in the terminal")
+	svgPath := flag.String("svg", "", "write the beam paths to an SVG file at this path, shaded by the timelines through each cell")
+	cellSize := flag.Int("cell-size", 12, "size in pixels of each cell in the SVG")
+	leftChance := flag.String("p", "", "follow a single particle that each ^ splitter sends left with this probability, such as 1/3 or 0.25")
+	splitterChances := flag.String("splitter-p", "", "space separated row,col=probability overrides for particular ^ splitters, used with -p")
+	flag.Parse()
+
+	if *asCSV && !*report {
+		panic(errors.New("-csv prints the report as CSV, so it needs -report"))
+	}
+
+	if *splitterChances != "" && *leftChance == "" {
+		panic(errors.New("-splitter-p overrides the odds given by -p, so it needs -p"))
+	}
+
 	path := filepath.Join("inputs/day07.txt")
 	f, err := os.Open(path)
 	if err != nil {
@@ -53,51 +455,81 @@ func main() {
 
 	sc := bufio.NewScanner(f)
 
-	tachyonBeamPositions := map[int]bool{}
-	room := make(Room)
-	var startRow, startCol int
-	var partOneSplitNum int
-	var row int
+	manifold, err := parseManifold(sc, elements)
+	if err != nil {
+		panic(err)
+	}
 
-	for sc.Scan() {
-		line := []rune(sc.Text())
+	if *injectCols != "" {
+		var cols []int
+		for _, field := range strings.Split(*injectCols, ",") {
+			col, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil {
+				panic(err)
+			}
+			cols = append(cols, col)
+		}
 
-		if _, ok := room[row]; !ok {
-			room[row] = map[int]rune{}
+		if err := manifold.inject(cols); err != nil {
+			panic(err)
 		}
+	}
 
-		for col, r := range line {
-			room[row][col] = r
+	if len(manifold.sources) == 0 {
+		panic(errors.New("no beam sources in manifold"))
+	}
 
-			if r == 'S' {
-				startRow = row
-				startCol = col
-				if _, ok := tachyonBeamPositions[col]; !ok {
-					tachyonBeamPositions[col] = true
-				}
-			}
+	partOneSplitNum := manifold.countSplits(manifold.sources)
+
+	sourceTimelines, err := manifold.countTimelines()
+	if err != nil {
+		panic(err)
+	}
 
-			if r == '^' {
-				//splitterPositions = append(splitterPositions, SplitterPosition{Row: row, Col: col})
-				if _, ok := tachyonBeamPositions[col]; ok {
-					partOneSplitNum++
-					delete(tachyonBeamPositions, col)
+	partTwoTimelines := 0
+	for _, timelines := range sourceTimelines {
+		partTwoTimelines += timelines
+	}
 
-					if _, ok := tachyonBeamPositions[col-1]; !ok {
-						tachyonBeamPositions[col-1] = true
-					}
+	if *render || *svgPath != "" || *report {
+		cellCounts, exitCounts, err := manifold.beamCounts(*render || *svgPath != "")
+		if err != nil {
+			panic(err)
+		}
 
-					if _, ok := tachyonBeamPositions[col+1]; !ok {
-						tachyonBeamPositions[col+1] = true
-					}
-				}
+		if *render {
+			fmt.Print(renderBeams(manifold, cellCounts))
+		}
+
+		if *svgPath != "" {
+			if err := writeBeamSVG(*svgPath, manifold, cellCounts, *cellSize); err != nil {
+				panic(err)
 			}
 		}
 
-		row++
+		if *report {
+			printExitReport(manifold, exitCounts, sourceTimelines, *asCSV)
+		}
 	}
 
-	partTwoTimelines := room.countTimelines(startRow, startCol)
+	if *leftChance != "" {
+		odds, err := manifold.parseSplitterOdds(*leftChance, *splitterChances)
+		if err != nil {
+			panic(err)
+		}
+
+		exitChances, lost, err := manifold.exitDistribution(odds)
+		if err != nil {
+			panic(err)
+		}
+
+		sourceExpected, err := manifold.expectedSplits(odds)
+		if err != nil {
+			panic(err)
+		}
+
+		printChanceReport(exitChances, lost, sourceExpected)
+	}
 
 	fmt.Printf("Part one number of splits: %d\n", partOneSplitNum)
 	fmt.Printf("Part two number of timelines: %d\n", partTwoTimelines)
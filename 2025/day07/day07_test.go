@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"math/big"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var example = []string{
+	".......S.......",
+	"...............",
+	".......^.......",
+	"...............",
+	"......^.^......",
+	"...............",
+	".....^.^.^.....",
+	"...............",
+	"....^.^...^....",
+	"...............",
+	"...^.^...^.^...",
+	"...............",
+	"..^...^.....^..",
+	"...............",
+	".^.^.^.^.^...^.",
+	"...............",
+}
+
+func parseLines(t *testing.T, lines []string) Manifold {
+	t.Helper()
+
+	m, err := parseManifold(bufio.NewScanner(strings.NewReader(strings.Join(lines, "\n"))), elements)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func sum(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+
+	return total
+}
+
+// TestExample checks the puzzle's example, asking the same manifold for its
+// answers more than once to make sure nothing is left over between calls
+func TestExample(t *testing.T) {
+	m := parseLines(t, example)
+
+	if !m.downward {
+		t.Fatal("example should be followed a row at a time")
+	}
+
+	for range 3 {
+		if splits := m.countSplits(m.sources); splits != 21 {
+			t.Errorf("found %d splits, want 21", splits)
+		}
+
+		sourceTimelines, err := m.countTimelines()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if timelines := sum(sourceTimelines); timelines != 40 {
+			t.Errorf("found %d timelines, want 40", timelines)
+		}
+
+		_, exitCounts, err := m.beamCounts(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if timelines := sum(exitCounts); timelines != 40 {
+			t.Errorf("%d timelines leave the bottom, want 40", timelines)
+		}
+	}
+}
+
+// randomManifold builds a manifold of random elements from the given set,
+// with one to three sources on it
+func randomManifold(rng *rand.Rand, cells string) []string {
+	height, width := 1+rng.Intn(10), 1+rng.Intn(10)
+
+	lines := make([][]byte, height)
+	for row := range lines {
+		lines[row] = make([]byte, width)
+		for col := range lines[row] {
+			lines[row][col] = cells[rng.Intn(len(cells))]
+		}
+	}
+
+	for range 1 + rng.Intn(3) {
+		lines[rng.Intn(height)][rng.Intn(width)] = 'S'
+	}
+
+	manifold := make([]string, height)
+	for row := range lines {
+		manifold[row] = string(lines[row])
+	}
+
+	return manifold
+}
+
+func sameRats(a, b []*big.Rat) bool {
+	return slices.EqualFunc(a, b, func(x, y *big.Rat) bool { return x.Cmp(y) == 0 })
+}
+
+// TestRowsMatchStates checks that following the beams a row at a time gives
+// the same answers as following them through every beam state
+func TestRowsMatchStates(t *testing.T) {
+	rng := rand.New(rand.NewSource(46))
+
+	odds, err := parseChance("1/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 500 {
+		lines := randomManifold(rng, "....^^v#")
+
+		byRow := parseLines(t, lines)
+		if !byRow.downward {
+			t.Fatalf("manifold %q should be followed a row at a time", lines)
+		}
+		if rng.Intn(2) == 0 {
+			if err := byRow.inject([]int{rng.Intn(byRow.width)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		byState := byRow
+		byState.downward = false
+
+		if !slices.EqualFunc(byRow.activatedSplitters(byRow.sources), byState.activatedSplitters(byState.sources), slices.Equal) {
+			t.Fatalf("manifold %q: activated splitters differ", lines)
+		}
+
+		rowTimelines, _ := byRow.countTimelines()
+		stateTimelines, err := byState.countTimelines()
+		if err != nil || !slices.Equal(rowTimelines, stateTimelines) {
+			t.Fatalf("manifold %q: timelines %v by row and %v by state (%v)", lines, rowTimelines, stateTimelines, err)
+		}
+
+		rowCells, rowExits, _ := byRow.beamCounts(true)
+		stateCells, stateExits, err := byState.beamCounts(true)
+		if err != nil || !slices.Equal(rowExits, stateExits) || !slices.EqualFunc(rowCells, stateCells, slices.Equal) {
+			t.Fatalf("manifold %q: beam counts differ (%v)", lines, err)
+		}
+
+		splitterOdds := splitterOdds{left: odds, bySplitter: map[cellPos]*big.Rat{}}
+
+		rowChances, rowLost, _ := byRow.exitDistribution(splitterOdds)
+		stateChances, stateLost, err := byState.exitDistribution(splitterOdds)
+		if err != nil || !sameRats(rowChances, stateChances) || rowLost.Cmp(stateLost) != 0 {
+			t.Fatalf("manifold %q: exit chances differ (%v)", lines, err)
+		}
+
+		rowExpected, _ := byRow.expectedSplits(splitterOdds)
+		stateExpected, err := byState.expectedSplits(splitterOdds)
+		if err != nil || !sameRats(rowExpected, stateExpected) {
+			t.Fatalf("manifold %q: expected splits %v by row and %v by state (%v)", lines, rowExpected, stateExpected, err)
+		}
+	}
+}
+
+// TestLoop checks that beams going round a ring of mirrors are reported as a
+// loop rather than counted forever
+func TestLoop(t *testing.T) {
+	m := parseLines(t, []string{
+		`/S\`,
+		`.^.`,
+		`\./`,
+	})
+
+	if m.downward {
+		t.Fatal("a manifold with mirrors can't be followed a row at a time")
+	}
+
+	// Every splitter reached is still found
+	if splits := m.countSplits(m.sources); splits != 1 {
+		t.Errorf("found %d splits, want 1", splits)
+	}
+
+	odds := splitterOdds{left: big.NewRat(1, 2), bySplitter: map[cellPos]*big.Rat{}}
+
+	_, timelinesErr := m.countTimelines()
+	_, _, countsErr := m.beamCounts(false)
+	_, _, chancesErr := m.exitDistribution(odds)
+	_, expectedErr := m.expectedSplits(odds)
+
+	for _, err := range []error{timelinesErr, countsErr, chancesErr, expectedErr} {
+		if err == nil || !strings.Contains(err.Error(), "loop") {
+			t.Errorf("got error %v, want a loop", err)
+		}
+	}
+}
+
+// TestExitChancesSumToOne checks that the chance of leaving through each
+// column and the chance of being lost add up to exactly 1, on manifolds with
+// and without mirrors
+func TestExitChancesSumToOne(t *testing.T) {
+	rng := rand.New(rand.NewSource(47))
+
+	for _, cells := range []string{"....^^v#", `....^^v#/\`} {
+		for range 300 {
+			lines := randomManifold(rng, cells)
+			m := parseLines(t, lines)
+
+			left := big.NewRat(int64(rng.Intn(5)), 4)
+			odds := splitterOdds{left: left, bySplitter: map[cellPos]*big.Rat{}}
+
+			exitChances, lost, err := m.exitDistribution(odds)
+			if err != nil {
+				// Mirrors can send the beams round a loop
+				continue
+			}
+
+			total := new(big.Rat).Set(lost)
+			for _, chance := range exitChances {
+				if chance.Sign() < 0 {
+					t.Fatalf("manifold %q: negative exit chance %s", lines, chance)
+				}
+				total.Add(total, chance)
+			}
+
+			if lost.Sign() < 0 || total.Cmp(big.NewRat(1, 1)) != 0 {
+				t.Fatalf("manifold %q with left odds %s: chances add up to %s with %s lost", lines, left, total, lost)
+			}
+		}
+	}
+
+	m := parseLines(t, example)
+	_, lost, err := m.exitDistribution(splitterOdds{left: big.NewRat(1, 3), bySplitter: map[cellPos]*big.Rat{}})
+	if err != nil || lost.Sign() != 0 {
+		t.Errorf("example lost %s of the particle (%v), want none", lost, err)
+	}
+}
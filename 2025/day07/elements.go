@@ -0,0 +1,101 @@
+package main
+
+// direction is the way a beam is travelling through the manifold
+type direction uint8
+
+const (
+	down direction = iota
+	left
+	right
+	up
+	numDirections
+)
+
+var directionOffsets = [numDirections]struct{ row, col int }{
+	down:  {row: 1, col: 0},
+	left:  {row: 0, col: -1},
+	right: {row: 0, col: 1},
+	up:    {row: -1, col: 0},
+}
+
+// step is where a beam goes after it passes through an element, as an
+// offset from the element's cell and the direction it is then travelling in
+type step struct {
+	row int
+	col int
+	dir direction
+}
+
+// element is how one kind of cell in the manifold treats a beam. exits gives
+// every beam that leaves the cell when a beam enters it travelling in dir,
+// so an element that returns more than one step is a splitter and one that
+// returns none absorbs the beam.
+type element struct {
+	exits func(dir direction) []step
+
+	// twoWay marks a splitter that splits a beam into one going left and one
+	// going right, which the -p odds choose between
+	twoWay bool
+}
+
+// splits reports whether a beam entering the element travelling in dir is
+// split into more than one beam
+func (e element) splits(dir direction) bool {
+	return len(e.exits(dir)) > 1
+}
+
+// keepsDown reports whether every beam leaving the element after one enters
+// it travelling down is also travelling down on the row below
+func (e element) keepsDown() bool {
+	for _, s := range e.exits(down) {
+		if s.row != 1 || s.dir != down {
+			return false
+		}
+	}
+
+	return true
+}
+
+// passThrough carries a beam on in the direction it is already travelling
+func passThrough(dir direction) []step {
+	offset := directionOffsets[dir]
+	return []step{{row: offset.row, col: offset.col, dir: dir}}
+}
+
+// turn builds a mirror that sends a beam travelling in each direction off in
+// the direction it maps to
+func turn(turns [numDirections]direction) func(dir direction) []step {
+	return func(dir direction) []step {
+		return passThrough(turns[dir])
+	}
+}
+
+// splitDown builds a splitter that splits a beam travelling down into a beam
+// for each column offset on the row below, and lets beams travelling any
+// other way pass through
+func splitDown(colOffsets ...int) func(dir direction) []step {
+	return func(dir direction) []step {
+		if dir != down {
+			return passThrough(dir)
+		}
+
+		steps := make([]step, len(colOffsets))
+		for i, colOffset := range colOffsets {
+			steps[i] = step{row: 1, col: colOffset, dir: down}
+		}
+
+		return steps
+	}
+}
+
+// elements is the table of every kind of cell the manifold can hold. New kinds
+// of cell only need an entry here.
+var elements = map[byte]element{
+	'.':  {exits: passThrough},
+	'S':  {exits: passThrough},
+	'^':  {exits: splitDown(-1, 1), twoWay: true},
+	'v':  {exits: splitDown(-1, 0, 1)},
+	'#':  {exits: func(direction) []step { return nil }},
+	'/':  {exits: turn([numDirections]direction{down: left, left: down, right: up, up: right})},
+	'\\': {exits: turn([numDirections]direction{down: right, right: down, left: up, up: left})},
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// cellPos is the row and column of a cell in the manifold
+type cellPos struct {
+	row int
+	col int
+}
+
+// splitterOdds holds the chance that a two-way splitter sends a particle
+// left rather than right, either for every splitter or overridden for
+// particular ones
+type splitterOdds struct {
+	left       *big.Rat
+	bySplitter map[cellPos]*big.Rat
+}
+
+// parseChance reads a probability written as a fraction like 1/3 or a
+// decimal like 0.25
+func parseChance(s string) (*big.Rat, error) {
+	chance, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return nil, fmt.Errorf("invalid probability %q", s)
+	}
+
+	if chance.Sign() < 0 || chance.Cmp(big.NewRat(1, 1)) > 0 {
+		return nil, fmt.Errorf("probability %q is not between 0 and 1", s)
+	}
+
+	return chance, nil
+}
+
+// parseSplitterOdds reads the chance of going left for every splitter, along
+// with overrides written as row,col=chance separated by spaces. Each override
+// has to be for a two-way splitter in the manifold.
+func (m Manifold) parseSplitterOdds(left string, overrides string) (splitterOdds, error) {
+	leftChance, err := parseChance(left)
+	if err != nil {
+		return splitterOdds{}, err
+	}
+
+	odds := splitterOdds{left: leftChance, bySplitter: map[cellPos]*big.Rat{}}
+
+	for _, override := range strings.Fields(overrides) {
+		pos, chance, ok := strings.Cut(override, "=")
+		if !ok {
+			return splitterOdds{}, fmt.Errorf("invalid splitter probability %q", override)
+		}
+
+		rowStr, colStr, ok := strings.Cut(pos, ",")
+		if !ok {
+			return splitterOdds{}, fmt.Errorf("invalid splitter position %q", pos)
+		}
+
+		row, err := strconv.Atoi(rowStr)
+		if err != nil {
+			return splitterOdds{}, err
+		}
+		col, err := strconv.Atoi(colStr)
+		if err != nil {
+			return splitterOdds{}, err
+		}
+
+		if row < 0 || row >= len(m.cells) || col < 0 || col >= m.width {
+			return splitterOdds{}, fmt.Errorf("splitter position %q is outside the manifold", pos)
+		}
+		if !m.elements[m.cells[row][col]].twoWay {
+			return splitterOdds{}, fmt.Errorf("splitter position %q holds %q, which is not a two-way splitter", pos, m.cells[row][col])
+		}
+
+		odds.bySplitter[cellPos{row: row, col: col}], err = parseChance(chance)
+		if err != nil {
+			return splitterOdds{}, err
+		}
+	}
+
+	return odds, nil
+}
+
+// branchChances finds the chance of a particle in a state taking each of the
+// beams that leave it, in the same order as moves. A two-way splitter sends
+// the particle down its left branch with its own odds and down its right
+// branch otherwise, and any other splitter picks each of its branches evenly.
+func (m Manifold) branchChances(id int, odds splitterOdds) []*big.Rat {
+	row, col, dir := m.stateAt(id)
+	e := m.elements[m.cells[row][col]]
+	steps := e.exits(dir)
+	chances := make([]*big.Rat, len(steps))
+
+	if e.twoWay && len(steps) > 1 {
+		left, ok := odds.bySplitter[cellPos{row: row, col: col}]
+		if !ok {
+			left = odds.left
+		}
+		right := new(big.Rat).Sub(big.NewRat(1, 1), left)
+
+		for i, s := range steps {
+			chances[i] = right
+			if s.col < 0 {
+				chances[i] = left
+			}
+		}
+
+		return chances
+	}
+
+	for i := range chances {
+		chances[i] = big.NewRat(1, int64(len(steps)))
+	}
+
+	return chances
+}
+
+// exitDistribution finds the exact chance of a particle leaving the bottom of
+// the manifold in each column, starting from one of the sources picked
+// evenly. It follows the chances forwards from the sources the same way
+// beamCounts follows the timelines, and whatever chance is left over is the
+// chance of the particle being absorbed or lost off the sides.
+func (m Manifold) exitDistribution(odds splitterOdds) (exitChances []*big.Rat, lost *big.Rat, err error) {
+	if m.downward {
+		exitChances = m.exitDistributionByRow(odds)
+	} else {
+		exitChances, err = m.exitDistributionByState(odds)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	lost = big.NewRat(1, 1)
+	for _, chance := range exitChances {
+		lost.Sub(lost, chance)
+	}
+
+	return exitChances, lost, nil
+}
+
+// exitDistributionByRow follows the chance of the particle being in each
+// column down the manifold a row at a time
+func (m Manifold) exitDistributionByRow(odds splitterOdds) []*big.Rat {
+	newRow := func() []*big.Rat {
+		chances := make([]*big.Rat, m.width)
+		for col := range chances {
+			chances[col] = new(big.Rat)
+		}
+
+		return chances
+	}
+
+	chances := newRow()
+	exitChances := newRow()
+
+	for row := range m.cells {
+		for _, source := range m.sources {
+			if startsOnRow(source, row) {
+				chances[source.col].Add(chances[source.col], big.NewRat(1, int64(len(m.sources))))
+			}
+		}
+
+		nextChances := newRow()
+
+		for col, chance := range chances {
+			if chance.Sign() == 0 {
+				continue
+			}
+
+			branchChances := m.branchChances(m.stateID(row, col, down), odds)
+
+			for i, move := range m.movesDown(row, col) {
+				branch := new(big.Rat).Mul(chance, branchChances[i])
+
+				switch {
+				case move.exitCol != -1:
+					exitChances[move.exitCol].Add(exitChances[move.exitCol], branch)
+				case move.next != -1:
+					nextChances[move.next].Add(nextChances[move.next], branch)
+				}
+			}
+		}
+
+		chances = nextChances
+	}
+
+	return exitChances
+}
+
+// exitDistributionByState follows the chances through every beam state
+func (m Manifold) exitDistributionByState(odds splitterOdds) ([]*big.Rat, error) {
+	starts := m.starts(m.sources)
+
+	order, loop := m.traverse(starts)
+	if loop != -1 {
+		return nil, m.loopError(loop)
+	}
+
+	chances := make([]*big.Rat, m.numStates())
+	for _, start := range starts {
+		if chances[start] == nil {
+			chances[start] = new(big.Rat)
+		}
+		chances[start].Add(chances[start], big.NewRat(1, int64(len(starts))))
+	}
+
+	exitChances := make([]*big.Rat, m.width)
+	for col := range exitChances {
+		exitChances[col] = new(big.Rat)
+	}
+
+	for _, id := range order {
+		if chances[id] == nil {
+			continue
+		}
+
+		branchChances := m.branchChances(id, odds)
+
+		for i, move := range m.moves(id) {
+			branch := new(big.Rat).Mul(chances[id], branchChances[i])
+
+			switch {
+			case move.exitCol != -1:
+				exitChances[move.exitCol].Add(exitChances[move.exitCol], branch)
+			case move.next != -1:
+				if chances[move.next] == nil {
+					chances[move.next] = new(big.Rat)
+				}
+				chances[move.next].Add(chances[move.next], branch)
+			}
+		}
+	}
+
+	return exitChances, nil
+}
+
+// expectedSplits finds the expected number of splitters a particle from each
+// source passes through on its way out of the manifold. It works back from
+// the states closest to the exits like countTimelines, but each state's
+// expected splits are its branches' expected splits weighted by their
+// chances, plus one if the state is a split.
+func (m Manifold) expectedSplits(odds splitterOdds) ([]*big.Rat, error) {
+	if m.downward {
+		return m.expectedSplitsByRow(odds), nil
+	}
+
+	starts := m.starts(m.sources)
+
+	order, loop := m.traverse(starts)
+	if loop != -1 {
+		return nil, m.loopError(loop)
+	}
+
+	expected := make([]*big.Rat, m.numStates())
+
+	for i := len(order) - 1; i >= 0; i-- {
+		id := order[i]
+		row, col, dir := m.stateAt(id)
+
+		expected[id] = new(big.Rat)
+		if m.elements[m.cells[row][col]].splits(dir) {
+			expected[id].SetInt64(1)
+		}
+
+		branchChances := m.branchChances(id, odds)
+
+		for j, move := range m.moves(id) {
+			if move.next != -1 {
+				expected[id].Add(expected[id], new(big.Rat).Mul(branchChances[j], expected[move.next]))
+			}
+		}
+	}
+
+	sourceExpected := make([]*big.Rat, len(starts))
+	for i, start := range starts {
+		sourceExpected[i] = expected[start]
+	}
+
+	return sourceExpected, nil
+}
+
+// expectedSplitsByRow works from the bottom row up like countTimelinesByRow,
+// keeping only the expected splits from each column of the row below
+func (m Manifold) expectedSplitsByRow(odds splitterOdds) []*big.Rat {
+	sourceExpected := make([]*big.Rat, len(m.sources))
+	var below []*big.Rat
+
+	for row := len(m.cells) - 1; row >= 0; row-- {
+		expected := make([]*big.Rat, m.width)
+
+		for col := range expected {
+			expected[col] = new(big.Rat)
+
+			moves := m.movesDown(row, col)
+			if len(moves) > 1 {
+				expected[col].SetInt64(1)
+			}
+
+			branchChances := m.branchChances(m.stateID(row, col, down), odds)
+
+			for i, move := range moves {
+				if move.next != -1 {
+					expected[col].Add(expected[col], new(big.Rat).Mul(branchChances[i], below[move.next]))
+				}
+			}
+		}
+
+		for i, source := range m.sources {
+			if startsOnRow(source, row) {
+				sourceExpected[i] = expected[source.col]
+			}
+		}
+
+		below = expected
+	}
+
+	return sourceExpected
+}
+
+// printChanceReport prints the chance of a particle leaving through each
+// bottom row column and the expected number of splitters it hits
+func printChanceReport(exitChances []*big.Rat, lost *big.Rat, sourceExpected []*big.Rat) {
+	fmt.Println("Exit column chances:")
+	for col, chance := range exitChances {
+		if chance.Sign() > 0 {
+			fmt.Printf("  %d: %s (%s)\n", col, chance.RatString(), chance.FloatString(6))
+		}
+	}
+	fmt.Printf("  absorbed or lost: %s (%s)\n", lost.RatString(), lost.FloatString(6))
+
+	// A particle starts from each source evenly, so its expected splits are
+	// the average over the sources
+	total := new(big.Rat)
+	for i, expected := range sourceExpected {
+		fmt.Printf("Source %d expected splitters hit: %s (%s)\n", i+1, expected.RatString(), expected.FloatString(6))
+		total.Add(total, expected)
+	}
+	total.Quo(total, big.NewRat(int64(len(sourceExpected)), 1))
+
+	fmt.Printf("Expected splitters hit: %s (%s)\n", total.RatString(), total.FloatString(6))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"os"
+	"strings"
+)
+
+// renderBeams draws the manifold in the terminal with the cells the beams
+// pass through marked in yellow, the splitters that split them in red and
+// the elements they never reach dimmed. Every red splitter is one of part
+// one's splits, while part two's timelines are all of the paths through the
+// yellow cells.
+func renderBeams(m Manifold, counts [][]int) string {
+	activated := m.activatedSplitters(m.sources)
+
+	var sb strings.Builder
+
+	for row := range m.cells {
+		for col, c := range m.cells[row] {
+			hasBeam := counts[row][col] > 0
+
+			switch {
+			case c == 'S':
+				sb.WriteString("\033[1;32mS\033[0m")
+			case activated[row][col]:
+				sb.WriteString("\033[1;31m" + string(c) + "\033[0m")
+			case c == '.' && hasBeam:
+				sb.WriteString("\033[33m|\033[0m")
+			case hasBeam:
+				sb.WriteString("\033[1;33m" + string(c) + "\033[0m")
+			case c != '.':
+				sb.WriteString("\033[2m" + string(c) + "\033[0m")
+			default:
+				sb.WriteByte(c)
+			}
+		}
+		sb.WriteByte('\n')
+	}
+
+	return sb.String()
+}
+
+// writeBeamSVG draws the manifold as an SVG with every cell coloured by the
+// log of the number of timelines passing through it, so the few paths near
+// the source and the many near the bottom both stay visible. Splitters are
+// drawn as triangles, filled if they split a beam, and other elements as
+// their own character.
+func writeBeamSVG(path string, m Manifold, counts [][]int, cellSize int) error {
+	activated := m.activatedSplitters(m.sources)
+
+	maxCount := 0
+	for row := range counts {
+		for _, count := range counts[row] {
+			maxCount = max(maxCount, count)
+		}
+	}
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\">\n",
+		m.width*cellSize, len(m.cells)*cellSize)
+	fmt.Fprintf(&sb, "<rect width=\"100%%\" height=\"100%%\" fill=\"#1e1e24\"/>\n")
+
+	for row := range m.cells {
+		for col, c := range m.cells[row] {
+			x, y := col*cellSize, row*cellSize
+			count := counts[row][col]
+
+			if count > 0 {
+				// Scale from a dim orange for a single timeline up to a
+				// bright yellow for the busiest cell
+				shade := 1.0
+				if maxCount > 1 {
+					shade = math.Log(float64(count)) / math.Log(float64(maxCount))
+				}
+
+				fmt.Fprintf(&sb, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"rgb(%d,%d,%d)\"><title>%d</title></rect>\n",
+					x, y, cellSize, cellSize,
+					0x60+int(shade*0x9f), 0x30+int(shade*0xc0), 0x20+int(shade*0x20), count)
+			}
+
+			fill := "none"
+			if activated[row][col] {
+				fill = "#e04030"
+			}
+
+			switch c {
+			case '.':
+			case '^':
+				fmt.Fprintf(&sb, "<polygon points=\"%d,%d %d,%d %d,%d\" fill=\"%s\" stroke=\"#d8d0b8\"/>\n",
+					x+cellSize/2, y+1, x+1, y+cellSize-1, x+cellSize-1, y+cellSize-1, fill)
+			case 'S':
+				fmt.Fprintf(&sb, "<circle cx=\"%d\" cy=\"%d\" r=\"%d\" fill=\"#40c040\"/>\n",
+					x+cellSize/2, y+cellSize/2, cellSize/3)
+			default:
+				if fill == "none" {
+					fill = "#d8d0b8"
+				}
+
+				fmt.Fprintf(&sb, "<text x=\"%d\" y=\"%d\" font-size=\"%d\" font-family=\"monospace\" text-anchor=\"middle\" dominant-baseline=\"central\" fill=\"%s\">%s</text>\n",
+					x+cellSize/2, y+cellSize/2, cellSize, fill, html.EscapeString(string(c)))
+			}
+		}
+	}
+
+	sb.WriteString("</svg>\n")
+
+	return os.WriteFile(path, []byte(sb.String()), 0o644)
+}
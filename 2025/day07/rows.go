@@ -0,0 +1,133 @@
+package main
+
+// These follow the beams down the manifold a row at a time, for manifolds
+// where every beam keeps travelling down. They only hold a value for each
+// column of one or two rows, so they need O(width) memory no matter how
+// tall the manifold is.
+
+// startsOnRow reports whether a source's beam begins on row, where injected
+// beams begin on the top row
+func startsOnRow(source beamSource, row int) bool {
+	return max(source.row, 0) == row
+}
+
+// movesDown finds where each of the beams leaving a cell goes when a beam
+// enters it travelling down, giving the column on the row below for beams
+// that stay in the manifold
+func (m Manifold) movesDown(row, col int) []beamMove {
+	moves := m.moves(m.stateID(row, col, down))
+
+	for i, move := range moves {
+		if move.next != -1 {
+			_, moves[i].next, _ = m.stateAt(move.next)
+		}
+	}
+
+	return moves
+}
+
+// visitSplitsByRow follows the beams from the sources down the manifold and
+// visits every splitter that a beam reaches
+func (m Manifold) visitSplitsByRow(sources []beamSource, visit func(row, col int)) {
+	beams := make([]bool, m.width)
+
+	for row := range m.cells {
+		for _, source := range sources {
+			if startsOnRow(source, row) {
+				beams[source.col] = true
+			}
+		}
+
+		nextBeams := make([]bool, m.width)
+
+		for col, hasBeam := range beams {
+			if !hasBeam {
+				continue
+			}
+
+			moves := m.movesDown(row, col)
+			if len(moves) > 1 {
+				visit(row, col)
+			}
+
+			for _, move := range moves {
+				if move.next != -1 {
+					nextBeams[move.next] = true
+				}
+			}
+		}
+
+		beams = nextBeams
+	}
+}
+
+// countTimelinesByRow works from the bottom row up, keeping only the number
+// of timelines from each column of the row below
+func (m Manifold) countTimelinesByRow() []int {
+	sourceTimelines := make([]int, len(m.sources))
+	var below []int
+
+	for row := len(m.cells) - 1; row >= 0; row-- {
+		timelines := make([]int, m.width)
+
+		for col := range timelines {
+			for _, move := range m.movesDown(row, col) {
+				switch {
+				case move.exitCol != -1:
+					timelines[col]++
+				case move.next != -1:
+					timelines[col] += below[move.next]
+				}
+			}
+		}
+
+		for i, source := range m.sources {
+			if startsOnRow(source, row) {
+				sourceTimelines[i] = timelines[source.col]
+			}
+		}
+
+		below = timelines
+	}
+
+	return sourceTimelines
+}
+
+// flowByRow follows the number of timelines in each column down from the
+// sources, handing the counts entering each row to visit, and returns the
+// number leaving the bottom in each column
+func (m Manifold) flowByRow(visit func(row int, counts []int)) []int {
+	counts := make([]int, m.width)
+	exitCounts := make([]int, m.width)
+
+	for row := range m.cells {
+		for _, source := range m.sources {
+			if startsOnRow(source, row) {
+				counts[source.col]++
+			}
+		}
+
+		visit(row, counts)
+
+		nextCounts := make([]int, m.width)
+
+		for col, count := range counts {
+			if count == 0 {
+				continue
+			}
+
+			for _, move := range m.movesDown(row, col) {
+				switch {
+				case move.exitCol != -1:
+					exitCounts[move.exitCol] += count
+				case move.next != -1:
+					nextCounts[move.next] += count
+				}
+			}
+		}
+
+		counts = nextCounts
+	}
+
+	return exitCounts
+}
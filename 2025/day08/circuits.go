@@ -0,0 +1,78 @@
+package main
+
+import (
+	"slices"
+)
+
+// circuits is a disjoint-set forest over junction box IDs, where each tree
+// is one circuit. Every box starts out in a circuit of its own.
+type circuits struct {
+	parent []int
+	size   []int
+	count  int
+}
+
+func newCircuits(numBoxes int) *circuits {
+	c := &circuits{
+		parent: make([]int, numBoxes),
+		size:   make([]int, numBoxes),
+		count:  numBoxes,
+	}
+
+	for id := range c.parent {
+		c.parent[id] = id
+		c.size[id] = 1
+	}
+
+	return c
+}
+
+// find returns the ID of the box at the root of the circuit that id is in,
+// and points every box on the way straight at the root so the next lookup
+// is quicker
+func (c *circuits) find(id int) int {
+	root := id
+	for c.parent[root] != root {
+		root = c.parent[root]
+	}
+
+	for c.parent[id] != root {
+		c.parent[id], id = root, c.parent[id]
+	}
+
+	return root
+}
+
+// connect joins the circuits that the two boxes are in, hanging the smaller
+// circuit off the larger one to keep the trees shallow. It reports whether
+// the boxes were in different circuits.
+func (c *circuits) connect(id1, id2 int) bool {
+	root1, root2 := c.find(id1), c.find(id2)
+	if root1 == root2 {
+		return false
+	}
+
+	if c.size[root1] < c.size[root2] {
+		root1, root2 = root2, root1
+	}
+
+	c.parent[root2] = root1
+	c.size[root1] += c.size[root2]
+	c.count--
+
+	return true
+}
+
+// largest returns the sizes of the n largest circuits, largest first
+func (c *circuits) largest(n int) []int {
+	var sizes []int
+	for id, parent := range c.parent {
+		if parent == id {
+			sizes = append(sizes, c.size[id])
+		}
+	}
+
+	slices.SortFunc(sizes, func(a, b int) int { return b - a })
+
+	return sizes[:min(n, len(sizes))]
+}
@@ -3,19 +3,16 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"math"
 	"os"
 	"path/filepath"
-	"slices"
-	"sort"
 	"strconv"
 	"strings"
 )
 
 type JunctionBoxPos struct {
-	X float64
-	Y float64
-	Z float64
+	X int
+	Y int
+	Z int
 }
 
 type JunctionBox struct {
@@ -23,161 +20,40 @@ type JunctionBox struct {
 }
 
 type JunctionBoxPair struct {
-	JunctionBox1 JunctionBoxPos
-	JunctionBox2 JunctionBoxPos
-	Distance     float64
-	Connected    bool
-}
-
-func findPosInCircuit(pos JunctionBoxPos, circuits [][]JunctionBoxPos) int {
-	var circuitIdx int
-
-	for i, c := range circuits {
-		circuitIdx = slices.IndexFunc(c, func(j JunctionBoxPos) bool { return j == pos })
-		if circuitIdx != -1 {
-			// Capture the outer index of the circuit that pos1 is in
-			return i
-		}
-	}
-
-	return -1
-}
-
-func modifyCircuits(
-	circuits [][]JunctionBoxPos,
-	circuitIdx1, circuitIdx2 int,
-	junctionBoxPos1, junctionBoxPos2 JunctionBoxPos,
-) [][]JunctionBoxPos {
-	var circuit []JunctionBoxPos
-
-	if circuitIdx1 == -1 && circuitIdx2 == -1 {
-		// Neither in an existing circuit, create a new one
-		circuit = append(circuit, junctionBoxPos1, junctionBoxPos2)
-		circuits = append(circuits, circuit)
-	} else if circuitIdx1 != -1 && circuitIdx2 == -1 {
-		// pos1 found but not pos2, add pos2 to pos1's circuit
-		existingCircuit := circuits[circuitIdx1]
-		existingCircuit = append(existingCircuit, junctionBoxPos2)
-		circuits[circuitIdx1] = existingCircuit
-	} else if circuitIdx1 == -1 && circuitIdx2 != -1 {
-		// pos2 found but not pos1, add pos1 to pos2's circuit
-		existingCircuit := circuits[circuitIdx2]
-		existingCircuit = append(existingCircuit, junctionBoxPos1)
-		circuits[circuitIdx2] = existingCircuit
-	} else {
-		circuit1 := circuits[circuitIdx1]
-		circuit2 := circuits[circuitIdx2]
-
-		// If both are found in two different circuits, merge the two circuits
-		// otherwise do nothing
-		if !slices.Equal(circuit1, circuit2) {
-			// Need to handle circuit index carefully - if circuitIdx1 > circuitIdx2,
-			// after removing circuitIdx2, circuitIdx1 shifts down by 1
-			if circuitIdx1 > circuitIdx2 {
-				// remove the second circuit from circuits
-				circuits = append(circuits[:circuitIdx2], circuits[circuitIdx2+1:]...)
-				// add the second circuit to the first circuit
-				circuit1 = append(circuit1, circuit2...)
-				// Update the merged circuit (index shifted down by 1)
-				circuits[circuitIdx1-1] = circuit1
-			} else {
-				// remove the second circuit from circuits
-				circuits = append(circuits[:circuitIdx2], circuits[circuitIdx2+1:]...)
-				// add the second circuit to the first circuit
-				circuit1 = append(circuit1, circuit2...)
-				// Update the merged circuit in the circuits slice
-				circuits[circuitIdx1] = circuit1
-			}
-		}
-	}
-
-	return circuits
-
+	BoxID1          int
+	BoxID2          int
+	DistanceSquared int
 }
 
 const maxConnections = 1000
 
-func partOne(junctionBoxPairs []JunctionBoxPair) ([][]JunctionBoxPos, int) {
-	var circuits [][]JunctionBoxPos
-
-	var numberOfConnections int
-	var nextJunctionBoxPair int
-
-	for i := range len(junctionBoxPairs) {
-		junctionBoxPos1 := junctionBoxPairs[i].JunctionBox1
-		junctionBoxPos2 := junctionBoxPairs[i].JunctionBox2
-
-		if !junctionBoxPairs[i].Connected {
-			// Connect the two junction boxes together
-			junctionBoxPairs[i].Connected = true
-
-			// Also mark the reciprocal pair as connected
-			for j := range junctionBoxPairs {
-				if junctionBoxPairs[j].JunctionBox1 == junctionBoxPos2 &&
-					junctionBoxPairs[j].JunctionBox2 == junctionBoxPos1 {
-					junctionBoxPairs[j].Connected = true
-					break
-				}
-			}
-
-			circuitIdx1 := findPosInCircuit(junctionBoxPos1, circuits)
-			circuitIdx2 := findPosInCircuit(junctionBoxPos2, circuits)
-
-			circuits = modifyCircuits(circuits, circuitIdx1, circuitIdx2, junctionBoxPos1, junctionBoxPos2)
-
-			// Count every connection attempt
-			numberOfConnections++
-		}
-
-		// Stop after 1000 connections
-		if numberOfConnections == maxConnections {
-			nextJunctionBoxPair = i + 1
+// partOne connects the closest maxConnections pairs of junction boxes,
+// counting every pair even if its boxes are already in the same circuit
+func partOne(pairs *pairStream, boxCircuits *circuits) {
+	for range maxConnections {
+		pair, ok := pairs.next()
+		if !ok {
 			break
 		}
-	}
-
-	sort.Slice(circuits, func(i, j int) bool {
-		return len(circuits[i]) > len(circuits[j])
-	})
 
-	return circuits, nextJunctionBoxPair
+		boxCircuits.connect(pair.BoxID1, pair.BoxID2)
+	}
 }
 
-func partTwo(junctionBoxPairs []JunctionBoxPair, nextJunctionBoxPair int, circuits [][]JunctionBoxPos) float64 {
-	var circuit1X, circuit2X float64
-
-	for i := nextJunctionBoxPair; i < len(junctionBoxPairs); i++ {
-		junctionBoxPos1 := junctionBoxPairs[i].JunctionBox1
-		junctionBoxPos2 := junctionBoxPairs[i].JunctionBox2
-
-		circuit1X = junctionBoxPos1.X
-		circuit2X = junctionBoxPos2.X
-
-		if !junctionBoxPairs[i].Connected {
-			// connect the two junction boxes together
-			junctionBoxPairs[i].Connected = true
-
-			// Also mark the reciprocal pair as connected
-			for j := range junctionBoxPairs {
-				if junctionBoxPairs[j].JunctionBox1 == junctionBoxPos2 &&
-					junctionBoxPairs[j].JunctionBox2 == junctionBoxPos1 {
-					junctionBoxPairs[j].Connected = true
-					break
-				}
-			}
-
-			circuitIdx1 := findPosInCircuit(junctionBoxPos1, circuits)
-			circuitIdx2 := findPosInCircuit(junctionBoxPos2, circuits)
-
-			circuits = modifyCircuits(circuits, circuitIdx1, circuitIdx2, junctionBoxPos1, junctionBoxPos2)
-
-			if len(circuits) == 1 {
-				break
-			}
+// partTwo finds the pair that joins the last two circuits into one if the
+// closest pairs keep being connected, and multiplies the X coordinates of
+// its boxes. That pair is the longest one in the minimum spanning tree, so
+// it can be found without going through every shorter pair, and it is the
+// same pair even if part one's connections already joined every box.
+func partTwo(tree *kdTree) int {
+	var last JunctionBoxPair
+	for i, pair := range tree.minimumSpanningTree() {
+		if i == 0 || pairLess(last, pair) {
+			last = pair
 		}
 	}
 
-	return circuit1X * circuit2X
+	return tree.boxes[last.BoxID1].Position.X * tree.boxes[last.BoxID2].Position.X
 }
 
 func main() {
@@ -191,70 +67,52 @@ func main() {
 
 	sc := bufio.NewScanner(f)
 
-	junctionBoxes := make(map[JunctionBoxPos]JunctionBox)
-	var junctionBoxPairs []JunctionBoxPair
+	junctionBoxIDs := make(map[JunctionBoxPos]int)
+	var junctionBoxes []JunctionBox
 
 	for sc.Scan() {
 		line := strings.Split(sc.Text(), ",")
-		posFloat := make([]float64, len(line))
+		pos := make([]int, len(line))
 
 		for i, v := range line {
 			val, err := strconv.Atoi(v)
 			if err != nil {
 				panic(err)
 			}
-			posFloat[i] = float64(val)
+			pos[i] = val
 		}
 
-		junctionBoxPos := JunctionBoxPos{X: posFloat[0], Y: posFloat[1], Z: posFloat[2]}
-		junctionBoxes[junctionBoxPos] = JunctionBox{Position: junctionBoxPos}
-	}
+		junctionBoxPos := JunctionBoxPos{X: pos[0], Y: pos[1], Z: pos[2]}
 
-	// Create all junction box pairs out of all junction boxes and add them to junctionBoxPairs
-	for pos1 := range junctionBoxes {
-		for pos2 := range junctionBoxes {
-			if pos1 != pos2 {
-				x := pos1.X - pos2.X
-				y := pos1.Y - pos2.Y
-				z := pos1.Z - pos2.Z
-				distance := math.Sqrt(math.Pow(x, 2) + math.Pow(y, 2) + math.Pow(z, 2))
-				junctionBoxPairs = append(junctionBoxPairs, JunctionBoxPair{
-					JunctionBox1: pos1,
-					JunctionBox2: pos2,
-					Distance:     distance,
-					Connected:    false,
-				})
-			}
+		// Boxes at the same position are the same box
+		if _, ok := junctionBoxIDs[junctionBoxPos]; ok {
+			continue
 		}
-	}
-
-	sort.Slice(junctionBoxPairs, func(i, j int) bool {
-		return junctionBoxPairs[i].Distance < junctionBoxPairs[j].Distance
-	})
 
-	circuits, nextJunctionBoxPair := partOne(junctionBoxPairs)
+		junctionBoxIDs[junctionBoxPos] = len(junctionBoxes)
+		junctionBoxes = append(junctionBoxes, JunctionBox{Position: junctionBoxPos})
+	}
 
-	fmt.Printf("Part one: Product of the three largest circuits: %d\n", len(circuits[0])*len(circuits[1])*len(circuits[2]))
+	if err := sc.Err(); err != nil {
+		panic(err)
+	}
 
-	// Add the unconnected junction boxes to circuits
-	for i := range junctionBoxes {
-		idx := -1
-		for j, c := range circuits {
-			idx = slices.IndexFunc(c, func(j JunctionBoxPos) bool { return j == i })
+	tree := newKDTree(junctionBoxes)
+	pairs := newPairStream(tree)
+	boxCircuits := newCircuits(len(junctionBoxes))
 
-			if idx != -1 {
-				// Capture the outer index of the circuit that pos1 is in
-				idx = j
-				break
-			}
-		}
+	partOne(pairs, boxCircuits)
 
-		if idx == -1 {
-			circuits = append(circuits, []JunctionBoxPos{i})
-		}
+	// Small inputs can end up in fewer than three circuits, which leaves part
+	// one without an answer but doesn't change part two's
+	largest := boxCircuits.largest(3)
+	if len(largest) < 3 {
+		fmt.Printf("Part one: Only %d circuits after %d connections\n", len(largest), maxConnections)
+	} else {
+		fmt.Printf("Part one: Product of the three largest circuits: %d\n", largest[0]*largest[1]*largest[2])
 	}
 
-	productXCoordLastJunctionBox := partTwo(junctionBoxPairs, nextJunctionBoxPair, circuits)
+	productXCoordLastJunctionBox := partTwo(tree)
 
-	fmt.Printf("Part two: Product of X coordinate of last two connected junction boxes: %.0f\n", productXCoordLastJunctionBox)
+	fmt.Printf("Part two: Product of X coordinate of last two connected junction boxes: %d\n", productXCoordLastJunctionBox)
 }
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"slices"
+)
+
+// maxLeafBoxes is the most junction boxes a k-d tree leaf holds before it is
+// split in two
+const maxLeafBoxes = 8
+
+func (p JunctionBoxPos) coord(axis int) int {
+	switch axis {
+	case 0:
+		return p.X
+	case 1:
+		return p.Y
+	default:
+		return p.Z
+	}
+}
+
+// kdNode is a box of space holding the junction boxes ids[lo:hi] of the tree.
+// A leaf has no children, and any other node is split into a left and right
+// child at the median of its widest axis.
+type kdNode struct {
+	lo    int
+	hi    int
+	min   [3]int
+	max   [3]int
+	left  int
+	right int
+
+	// component is the circuit every box in the node is in, or -1 if they
+	// aren't all in the same one. It is only kept up to date while building
+	// the minimum spanning tree.
+	component int
+}
+
+// kdTree is a k-d tree over the junction boxes, for finding the boxes closest
+// to a box without measuring the distance to every other box
+type kdTree struct {
+	boxes []JunctionBox
+	ids   []int
+	nodes []kdNode
+}
+
+func newKDTree(boxes []JunctionBox) *kdTree {
+	t := &kdTree{boxes: boxes, ids: make([]int, len(boxes))}
+	for i := range t.ids {
+		t.ids[i] = i
+	}
+
+	if len(boxes) > 0 {
+		t.build(0, len(boxes))
+	}
+
+	return t
+}
+
+// build adds the node holding ids[lo:hi] and everything below it, and returns
+// its index. The tree is balanced, so the recursion is only as deep as the
+// log of the number of boxes.
+func (t *kdTree) build(lo, hi int) int {
+	node := kdNode{lo: lo, hi: hi, left: -1, right: -1, component: -1}
+
+	for axis := range 3 {
+		node.min[axis] = t.boxes[t.ids[lo]].Position.coord(axis)
+		node.max[axis] = node.min[axis]
+
+		for _, id := range t.ids[lo:hi] {
+			c := t.boxes[id].Position.coord(axis)
+			node.min[axis] = min(node.min[axis], c)
+			node.max[axis] = max(node.max[axis], c)
+		}
+	}
+
+	idx := len(t.nodes)
+	t.nodes = append(t.nodes, node)
+
+	if hi-lo <= maxLeafBoxes {
+		return idx
+	}
+
+	axis := 0
+	for a := 1; a < 3; a++ {
+		if node.max[a]-node.min[a] > node.max[axis]-node.min[axis] {
+			axis = a
+		}
+	}
+
+	slices.SortFunc(t.ids[lo:hi], func(a, b int) int {
+		return t.boxes[a].Position.coord(axis) - t.boxes[b].Position.coord(axis)
+	})
+
+	mid := (lo + hi) / 2
+	left := t.build(lo, mid)
+	right := t.build(mid, hi)
+
+	t.nodes[idx].left = left
+	t.nodes[idx].right = right
+
+	return idx
+}
+
+// minDistanceSquared is the squared distance from pos to the closest point of
+// the node's box, which no junction box in the node can be closer than
+func (n kdNode) minDistanceSquared(pos JunctionBoxPos) int {
+	total := 0
+	for axis := range 3 {
+		c := pos.coord(axis)
+		gap := max(n.min[axis]-c, c-n.max[axis], 0)
+		total += gap * gap
+	}
+
+	return total
+}
+
+// maxDistanceSquared is the squared distance from pos to the furthest corner
+// of the node's box, which no junction box in the node can be further than
+func (n kdNode) maxDistanceSquared(pos JunctionBoxPos) int {
+	total := 0
+	for axis := range 3 {
+		c := pos.coord(axis)
+		gap := max(c-n.min[axis], n.max[axis]-c)
+		total += gap * gap
+	}
+
+	return total
+}
+
+// newPair builds the pair of two boxes with the lower ID first, so a pair is
+// always the same however it is found
+func (t *kdTree) newPair(id1, id2 int) JunctionBoxPair {
+	return JunctionBoxPair{
+		BoxID1:          min(id1, id2),
+		BoxID2:          max(id1, id2),
+		DistanceSquared: distanceSquared(t.boxes[id1].Position, t.boxes[id2].Position),
+	}
+}
+
+// pairSearch is a search of the tree for the closest pair to one box that
+// passes some test
+type pairSearch struct {
+	tree  *kdTree
+	id    int
+	best  JunctionBoxPair
+	found bool
+
+	// skipNode reports whether none of the boxes in a node can pass
+	skipNode func(n kdNode) bool
+	// accept reports whether the pair to another box passes
+	accept func(pair JunctionBoxPair) bool
+}
+
+func (s *pairSearch) search(nodeIdx int) {
+	n := s.tree.nodes[nodeIdx]
+	pos := s.tree.boxes[s.id].Position
+
+	// A node only has to be searched if a box in it could be at least as
+	// close as the best pair so far, since a pair at the same distance can
+	// still come first by ID
+	if s.found && n.minDistanceSquared(pos) > s.best.DistanceSquared {
+		return
+	}
+	if s.skipNode(n) {
+		return
+	}
+
+	if n.left == -1 {
+		for _, other := range s.tree.ids[n.lo:n.hi] {
+			if other == s.id {
+				continue
+			}
+
+			pair := s.tree.newPair(s.id, other)
+			if s.accept(pair) && (!s.found || pairLess(pair, s.best)) {
+				s.best = pair
+				s.found = true
+			}
+		}
+		return
+	}
+
+	// Search the closer child first so the best pair shrinks sooner
+	first, second := n.left, n.right
+	if s.tree.nodes[second].minDistanceSquared(pos) < s.tree.nodes[first].minDistanceSquared(pos) {
+		first, second = second, first
+	}
+
+	s.search(first)
+	s.search(second)
+}
+
+// nextNeighbor finds the closest pair from id to a box with a higher ID that
+// comes after the pair after, or the closest pair of all if after is nil
+func (t *kdTree) nextNeighbor(id int, after *JunctionBoxPair) (JunctionBoxPair, bool) {
+	pos := t.boxes[id].Position
+
+	s := pairSearch{
+		tree: t,
+		id:   id,
+		skipNode: func(n kdNode) bool {
+			// Every box in the node is closer than the pair already taken
+			return after != nil && n.maxDistanceSquared(pos) < after.DistanceSquared
+		},
+		accept: func(pair JunctionBoxPair) bool {
+			return pair.BoxID1 == id && (after == nil || pairLess(*after, pair))
+		},
+	}
+
+	s.search(0)
+
+	return s.best, s.found
+}
+
+// labelComponents records in every node the circuit all of its boxes are in,
+// if there is one
+func (t *kdTree) labelComponents(boxCircuits *circuits) {
+	// Children are always added after their parent, so walking the nodes
+	// backwards labels both children before the node above them
+	for i := len(t.nodes) - 1; i >= 0; i-- {
+		n := &t.nodes[i]
+
+		if n.left != -1 {
+			n.component = -1
+			if t.nodes[n.left].component == t.nodes[n.right].component {
+				n.component = t.nodes[n.left].component
+			}
+			continue
+		}
+
+		n.component = boxCircuits.find(t.ids[n.lo])
+		for _, id := range t.ids[n.lo+1 : n.hi] {
+			if boxCircuits.find(id) != n.component {
+				n.component = -1
+				break
+			}
+		}
+	}
+}
+
+// minimumSpanningTree finds the pairs that connect every junction box into
+// one circuit with the shortest total length, using Borůvka's algorithm. In
+// every round each circuit is joined to its closest box in another circuit,
+// so there are at most log2(boxes) rounds of one search per box. Pairs are
+// ordered by distance and then by ID, so they are never tied and the tree is
+// the same one that connecting the closest pairs in order builds.
+func (t *kdTree) minimumSpanningTree() []JunctionBoxPair {
+	boxCircuits := newCircuits(len(t.boxes))
+	var tree []JunctionBoxPair
+
+	for boxCircuits.count > 1 {
+		t.labelComponents(boxCircuits)
+
+		cheapest := make([]JunctionBoxPair, len(t.boxes))
+		hasCheapest := make([]bool, len(t.boxes))
+
+		for id := range t.boxes {
+			component := boxCircuits.find(id)
+
+			s := pairSearch{
+				tree:  t,
+				id:    id,
+				best:  cheapest[component],
+				found: hasCheapest[component],
+				skipNode: func(n kdNode) bool {
+					return n.component == component
+				},
+				accept: func(pair JunctionBoxPair) bool {
+					other := pair.BoxID1
+					if other == id {
+						other = pair.BoxID2
+					}
+
+					return boxCircuits.find(other) != component
+				},
+			}
+
+			s.search(0)
+
+			cheapest[component] = s.best
+			hasCheapest[component] = s.found
+		}
+
+		for component, pair := range cheapest {
+			if hasCheapest[component] && boxCircuits.connect(pair.BoxID1, pair.BoxID2) {
+				tree = append(tree, pair)
+			}
+		}
+	}
+
+	return tree
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"container/heap"
+)
+
+// distanceSquared is the exact squared straight line distance between two
+// junction boxes, which orders pairs the same way as the distance itself
+func distanceSquared(pos1, pos2 JunctionBoxPos) int {
+	x := pos1.X - pos2.X
+	y := pos1.Y - pos2.Y
+	z := pos1.Z - pos2.Z
+
+	return x*x + y*y + z*z
+}
+
+// pairLess orders pairs by distance, and pairs the same distance apart by
+// their box IDs, so no two different pairs are ever tied
+func pairLess(a, b JunctionBoxPair) bool {
+	if a.DistanceSquared != b.DistanceSquared {
+		return a.DistanceSquared < b.DistanceSquared
+	}
+	if a.BoxID1 != b.BoxID1 {
+		return a.BoxID1 < b.BoxID1
+	}
+
+	return a.BoxID2 < b.BoxID2
+}
+
+// pairHeap is a min-heap of junction box pairs ordered by pairLess
+type pairHeap []JunctionBoxPair
+
+func (h pairHeap) Len() int { return len(h) }
+
+func (h pairHeap) Less(i, j int) bool { return pairLess(h[i], h[j]) }
+
+func (h pairHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *pairHeap) Push(x any) { *h = append(*h, x.(JunctionBoxPair)) }
+
+func (h *pairHeap) Pop() any {
+	old := *h
+	pair := old[len(old)-1]
+	*h = old[:len(old)-1]
+
+	return pair
+}
+
+// pairStream hands out every unordered pair of junction boxes once, closest
+// first, without ever holding more than one pair per box. The heap holds
+// each box's closest pair to a box with a higher ID that hasn't been taken
+// yet, and whenever a box's pair is taken the tree finds its next one.
+type pairStream struct {
+	tree       *kdTree
+	candidates pairHeap
+}
+
+func newPairStream(tree *kdTree) *pairStream {
+	s := &pairStream{tree: tree}
+
+	for id := range tree.boxes {
+		if pair, ok := tree.nextNeighbor(id, nil); ok {
+			s.candidates = append(s.candidates, pair)
+		}
+	}
+
+	heap.Init(&s.candidates)
+
+	return s
+}
+
+// next takes the closest pair that hasn't been taken yet, and reports false
+// once every pair has been taken
+func (s *pairStream) next() (JunctionBoxPair, bool) {
+	if s.candidates.Len() == 0 {
+		return JunctionBoxPair{}, false
+	}
+
+	pair := heap.Pop(&s.candidates).(JunctionBoxPair)
+
+	if nextPair, ok := s.tree.nextNeighbor(pair.BoxID1, &pair); ok {
+		heap.Push(&s.candidates, nextPair)
+	}
+
+	return pair, true
+}